@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// privileged actions are written to admin_audit_log together with the request they came from.
+// Role changes record their entry in the transaction of the change, every other write under /admin
+// is wrapped in Audit, which compares the target before and after the handler
+
+// newAuditEntry starts the audit entry of a request, the service fills in the action, the target and the values.
+// The actor of an impersonation token is the impersonator
+func (s *Server) newAuditEntry(r *http.Request, claims *Claims) AuditEntry {
+	entry := AuditEntry{
+		ActorId:   claims.UserID,
+		ActorRole: claims.Role,
+		IP:        clientIP(r, s.trustProxy),
+		UserAgent: r.UserAgent(),
+		RequestId: middleware.GetReqID(r.Context()),
+	}
+	if claims.Impersonator != nil {
+		entry.ActorId = claims.Impersonator.UserID
+		entry.ActorRole = claims.Impersonator.Role
+	}
+	return entry
+}
+
+// auditTarget tells Audit what a route acts on and how to look at it
+type auditTarget struct {
+	kind    string                                            // one of the AUDIT_TARGET_* constants
+	id      func(r *http.Request) string                      // nil when the request creates the target
+	idField string                                            // the field of the created target's response that holds its id
+	load    func(ctx context.Context, id string) (any, error) // the target as the API shows it, nil when it doesn't exist
+}
+
+// bufferedResponse holds back the response of a handler until its audit entry is written
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: http.Header{}}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(data)
+}
+
+// Status is the status the handler answered with, 200 when it only wrote a body or nothing at all
+func (b *bufferedResponse) Status() int {
+	if b.status == 0 {
+		return http.StatusOK
+	}
+	return b.status
+}
+
+// flush sends the held back response
+func (b *bufferedResponse) flush(w http.ResponseWriter) {
+	for key, values := range b.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(b.Status())
+	if _, err := w.Write(b.body.Bytes()); err != nil {
+		log.Println("Error writing response: ", err)
+	}
+}
+
+// Audit records action once the handler succeeds, with the fields of the target that changed.
+// GET requests pass through. The response is held back until the entry is written: when it can't be
+// recorded the request fails with 500, although the change itself is already made
+func (s *Server) Audit(action string, target auditTarget) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			claims, ok := r.Context().Value(userContextKey).(*Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var id string
+			var before any
+			if target.id != nil {
+				id = target.id(r)
+				var err error
+				before, err = target.load(r.Context(), id)
+				if err != nil {
+					log.Println("Error loading audit target: ", err)
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			response := newBufferedResponse()
+			next.ServeHTTP(response, r)
+			if response.Status() >= http.StatusBadRequest {
+				response.flush(w)
+				return
+			}
+
+			// the change is made, its entry is written even when the client is gone
+			ctx := context.WithoutCancel(r.Context())
+			if target.id == nil {
+				var created map[string]any
+				decoder := json.NewDecoder(bytes.NewReader(response.body.Bytes()))
+				decoder.UseNumber()
+				if err := decoder.Decode(&created); err != nil {
+					log.Println("Error reading the id of the created audit target: ", err)
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				id = fmt.Sprint(created[target.idField])
+			}
+
+			after, err := target.load(ctx, id)
+			if err != nil {
+				log.Println("Error loading audit target: ", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			entry := s.newAuditEntry(r, claims)
+			entry.Action = action
+			entry.TargetType = target.kind
+			entry.TargetId = id
+			entry.OldValue, entry.NewValue, err = auditChanges(before, after)
+			if err != nil {
+				log.Println("Error encoding audit values: ", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := s.auditSvc.Record(ctx, entry); err != nil {
+				log.Println("Error recording audit entry: ", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			response.flush(w)
+		})
+	}
+}
+
+func auditURLParam(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return chi.URLParam(r, name)
+	}
+}
+
+// audit targets are loaded as an admin would see them, whatever the role of the actor
+
+func (s *Server) auditedUser() auditTarget {
+	return auditTarget{kind: AUDIT_TARGET_USER, id: auditURLParam("id"), load: s.loadAuditUser}
+}
+
+func (s *Server) auditedNewUser() auditTarget {
+	return auditTarget{kind: AUDIT_TARGET_USER, idField: "id", load: s.loadAuditUser}
+}
+
+func (s *Server) auditedTwoFactor() auditTarget {
+	return auditTarget{kind: AUDIT_TARGET_USER, id: auditURLParam("id"), load: s.loadAuditTwoFactor}
+}
+
+func (s *Server) auditedTask() auditTarget {
+	return auditTarget{kind: AUDIT_TARGET_TASK, id: auditURLParam("id"), load: s.loadAuditTask}
+}
+
+func (s *Server) auditedNewTask() auditTarget {
+	return auditTarget{kind: AUDIT_TARGET_TASK, idField: "id", load: s.loadAuditTask}
+}
+
+func (s *Server) auditedTaskItems() auditTarget {
+	return auditTarget{kind: AUDIT_TARGET_TASK, id: auditURLParam("id"), load: s.loadAuditTaskItems}
+}
+
+func (s *Server) auditedRole() auditTarget {
+	return auditTarget{kind: AUDIT_TARGET_ROLE, id: auditURLParam("name"), load: s.loadAuditRole}
+}
+
+func (s *Server) auditedNewRole() auditTarget {
+	return auditTarget{kind: AUDIT_TARGET_ROLE, idField: "name", load: s.loadAuditRole}
+}
+
+func (s *Server) auditedLockout() auditTarget {
+	id := func(r *http.Request) string {
+		return lockoutKindFromURL(r) + ":" + chi.URLParam(r, "key")
+	}
+	return auditTarget{kind: AUDIT_TARGET_LOCKOUT, id: id, load: s.loadAuditLockout}
+}
+
+func (s *Server) auditedSettings() auditTarget {
+	id := func(r *http.Request) string {
+		return AUDIT_TARGET_SETTINGS
+	}
+	return auditTarget{kind: AUDIT_TARGET_SETTINGS, id: id, load: s.loadAuditSettings}
+}
+
+func (s *Server) loadAuditUser(ctx context.Context, id string) (any, error) {
+	userId, err := ConvertToInt(id)
+	if err != nil {
+		return nil, nil
+	}
+	user, err := s.userSvc.GetUserById(ctx, userId, 0, ADMIN)
+	if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrIdMustBeGtZero) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newUserResponse(user), nil
+}
+
+func (s *Server) loadAuditTwoFactor(ctx context.Context, id string) (any, error) {
+	userId, err := ConvertToInt(id)
+	if err != nil {
+		return nil, nil
+	}
+	user, err := s.userSvc.GetUserById(ctx, userId, 0, ADMIN)
+	if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrIdMustBeGtZero) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status, err := s.twoFactorSvc.GetStatus(ctx, user.Id, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (s *Server) loadAuditTask(ctx context.Context, id string) (any, error) {
+	taskId, err := ConvertToInt(id)
+	if err != nil {
+		return nil, nil
+	}
+	task, err := s.taskSvc.GetTaskByItsId(ctx, taskId, 0, ADMIN)
+	if errors.Is(err, pgx.ErrNoRows) || errors.Is(err, ErrIdMustBeGtZero) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newTaskResponse(task), nil
+}
+
+func (s *Server) loadAuditTaskItems(ctx context.Context, id string) (any, error) {
+	taskId, err := ConvertToInt(id)
+	if err != nil {
+		return nil, nil
+	}
+	items, err := s.itemSvc.GetItemsByTaskId(ctx, taskId, 0, ADMIN)
+	if errors.Is(err, ErrTaskNotFound) || errors.Is(err, ErrIdMustBeGtZero) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"items": items}, nil
+}
+
+func (s *Server) loadAuditRole(ctx context.Context, name string) (any, error) {
+	role, err := s.roleSvc.GetRole(ctx, name)
+	if errors.Is(err, ErrRoleNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (s *Server) loadAuditLockout(ctx context.Context, id string) (any, error) {
+	lockouts, err := s.throttleSvc.GetLockouts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, lockout := range lockouts {
+		if lockout.Kind+":"+lockout.Key == id {
+			return lockout, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) loadAuditSettings(ctx context.Context, _ string) (any, error) {
+	required, err := s.settingsSvc.RequireAdminTwoFactor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return settingsResponse{RequireAdmin2FA: required}, nil
+}
+
+// auditFilterFromQuery reads the listing params and ?actor_id, ?action, ?target_type, ?target_id,
+// ?created_after and ?created_before
+func auditFilterFromQuery(r *http.Request) (AuditFilter, error) {
+	var filter AuditFilter
+	var err error
+
+	filter.PageParams, err = pageParamsFromQuery(r)
+	if err != nil {
+		return AuditFilter{}, err
+	}
+
+	query := r.URL.Query()
+	if actor := query.Get("actor_id"); actor != "" {
+		actorId, err := ConvertToInt(actor)
+		if err != nil || actorId < 1 {
+			return AuditFilter{}, ErrInvalidAuditFilter
+		}
+		filter.ActorId = &actorId
+	}
+	filter.Action = query.Get("action")
+	filter.TargetType = query.Get("target_type")
+	filter.TargetId = query.Get("target_id")
+
+	filter.CreatedAfter, err = timeFromQuery(r, "created_after")
+	if err != nil {
+		return AuditFilter{}, ErrInvalidAuditFilter
+	}
+	filter.CreatedBefore, err = timeFromQuery(r, "created_before")
+	if err != nil {
+		return AuditFilter{}, ErrInvalidAuditFilter
+	}
+	return filter, nil
+}
+
+func (s *Server) GetAuditLogHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filter, err := auditFilterFromQuery(r)
+	if err != nil {
+		log.Println("Error parsing audit filter: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := s.auditSvc.GetEntries(ctx, filter)
+	if err != nil {
+		log.Println("Error getting audit log: ", err)
+		http.Error(w, err.Error(), listErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, entries)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+var auditCSVHeader = []string{"id", "created_at", "actor_id", "actor_name", "actor_role", "action", "target_type", "target_id",
+	"old_value", "new_value", "ip", "user_agent", "request_id"}
+
+// ExportAuditLogHTTP answers with every entry the filter matches as CSV, old_value and new_value are JSON
+func (s *Server) ExportAuditLogHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filter, err := auditFilterFromQuery(r)
+	if err != nil {
+		log.Println("Error parsing audit filter: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the header goes out with the first row, until then an error can still be answered with its status
+	writer := csv.NewWriter(w)
+	started := false
+	start := func() error {
+		if started {
+			return nil
+		}
+		started = true
+		w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="admin_audit_log.csv"`)
+		return writer.Write(auditCSVHeader)
+	}
+
+	err = s.auditSvc.Export(ctx, filter, func(entry AuditEntry) error {
+		if err := start(); err != nil {
+			return err
+		}
+		record, err := auditCSVRecord(entry)
+		if err != nil {
+			return err
+		}
+		return writer.Write(record)
+	})
+	if err == nil {
+		err = start()
+	}
+	if err != nil {
+		log.Println("Error exporting audit log: ", err)
+		if !started {
+			http.Error(w, err.Error(), listErrorStatus(err))
+		}
+		return
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Println("Error writing CSV: ", err)
+	}
+}
+
+func auditCSVRecord(entry AuditEntry) ([]string, error) {
+	oldValue, err := auditCSVValue(entry.OldValue)
+	if err != nil {
+		return nil, err
+	}
+	newValue, err := auditCSVValue(entry.NewValue)
+	if err != nil {
+		return nil, err
+	}
+	record := []string{
+		strconv.Itoa(entry.Id),
+		entry.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.Itoa(entry.ActorId),
+		entry.ActorName,
+		entry.ActorRole,
+		entry.Action,
+		entry.TargetType,
+		entry.TargetId,
+		oldValue,
+		newValue,
+		entry.IP,
+		entry.UserAgent,
+		entry.RequestId,
+	}
+	for i, cell := range record {
+		record[i] = csvCell(cell)
+	}
+	return record, nil
+}
+
+func auditCSVValue(value map[string]any) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// csvCell keeps spreadsheets from running cells like user names and user agents as formulas
+func csvCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
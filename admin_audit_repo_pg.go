@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strconv"
+	"strings"
+)
+
+type AdminAuditPgRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAdminAuditPgRepository(pool *pgxpool.Pool) *AdminAuditPgRepository {
+	return &AdminAuditPgRepository{
+		pool: pool,
+	}
+}
+
+var (
+	auditIdDesc = sortKey[AuditEntry]{expr: "id", cast: "bigint", desc: true, value: func(e AuditEntry) string { return strconv.Itoa(e.Id) }}
+
+	// auditSorts has a single ordering, newest first, ?order=asc flips it
+	auditSorts = map[string][]sortKey[AuditEntry]{
+		"": {
+			{expr: "created_at", cast: "timestamptz", desc: true, value: func(e AuditEntry) string { return formatCursorTime(e.CreatedAt) }},
+			auditIdDesc,
+		},
+	}
+)
+
+const auditColumns = "id, COALESCE(actor_id, 0), actor_name, actor_role, action, target_type, target_id, old_value, new_value, ip, user_agent, request_id, created_at"
+
+func scanAuditEntry(row pgx.Row) (AuditEntry, error) {
+	var e AuditEntry
+	err := row.Scan(&e.Id, &e.ActorId, &e.ActorName, &e.ActorRole, &e.Action, &e.TargetType, &e.TargetId,
+		&e.OldValue, &e.NewValue, &e.IP, &e.UserAgent, &e.RequestId, &e.CreatedAt)
+	return e, err
+}
+
+// recordAdminAudit writes entry in the transaction of the change it describes, so a change is never
+// made without its entry. The actor's name is looked up here, an actor who just deleted their own
+// account is recorded without an id and as #id
+func recordAdminAudit(ctx context.Context, tx pgx.Tx, entry AuditEntry) error {
+	query := `INSERT INTO admin_audit_log (actor_id, actor_name, actor_role, action, target_type, target_id, old_value, new_value, ip, user_agent, request_id)
+		SELECT (SELECT id FROM users WHERE id = $1), COALESCE((SELECT name FROM users WHERE id = $1), $11), $2, $3, $4, $5, $6, $7, $8, $9, $10`
+	_, err := tx.Exec(ctx, query, entry.ActorId, entry.ActorRole, entry.Action, entry.TargetType, entry.TargetId,
+		entry.OldValue, entry.NewValue, entry.IP, entry.UserAgent, entry.RequestId, "#"+strconv.Itoa(entry.ActorId))
+	return err
+}
+
+// Record writes an entry for a change that was made outside of it, see Server.Audit
+func (ar *AdminAuditPgRepository) Record(ctx context.Context, entry AuditEntry) error {
+	tx, err := ar.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := recordAdminAudit(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// auditWhere turns the filter into conditions, placeholders continue after args
+func auditWhere(filter AuditFilter) ([]string, []any) {
+	var where []string
+	var args []any
+	add := func(cond string, value any) {
+		args = append(args, value)
+		where = append(where, cond+" $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.ActorId != nil {
+		add("actor_id =", *filter.ActorId)
+	}
+	if filter.Action != "" {
+		add("action =", filter.Action)
+	}
+	if filter.TargetType != "" {
+		add("target_type =", filter.TargetType)
+	}
+	if filter.TargetId != "" {
+		add("target_id =", filter.TargetId)
+	}
+	if filter.CreatedAfter != nil {
+		add("created_at >", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		add("created_at <", *filter.CreatedBefore)
+	}
+	return where, args
+}
+
+func (ar *AdminAuditPgRepository) GetAll(ctx context.Context, filter AuditFilter) (Page[AuditEntry], error) {
+	keys, ok := resolveSort(auditSorts, filter.Sort, filter.Order)
+	if !ok {
+		return Page[AuditEntry]{}, ErrInvalidAuditSort
+	}
+
+	where, args := auditWhere(filter)
+	where, args, err := applyCursor(where, args, keys, filter.PageParams)
+	if err != nil {
+		return Page[AuditEntry]{}, err
+	}
+
+	query := "SELECT " + auditColumns + " FROM admin_audit_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, filter.Limit+1)
+	query += " ORDER BY " + orderByClause(keys) + " LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := ar.pool.Query(ctx, query, args...)
+	if err != nil {
+		return Page[AuditEntry]{}, cursorError(err, filter.PageParams)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return Page[AuditEntry]{}, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return Page[AuditEntry]{}, cursorError(err, filter.PageParams)
+	}
+
+	return newPage(entries, keys, filter.PageParams), nil
+}
+
+// Export calls fn with every entry the filter matches, in the order of the listing. Pagination
+// params other than the order are ignored, the rows are streamed instead of loaded at once
+func (ar *AdminAuditPgRepository) Export(ctx context.Context, filter AuditFilter, fn func(AuditEntry) error) error {
+	keys, ok := resolveSort(auditSorts, filter.Sort, filter.Order)
+	if !ok {
+		return ErrInvalidAuditSort
+	}
+
+	where, args := auditWhere(filter)
+	query := "SELECT " + auditColumns + " FROM admin_audit_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY " + orderByClause(keys)
+
+	rows, err := ar.pool.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+)
+
+// AdminAuditService keeps the admin audit log, who did what to which target and from where
+type AdminAuditService struct {
+	repo AdminAuditRepository
+}
+
+func NewAdminAuditService(repo AdminAuditRepository) *AdminAuditService {
+	return &AdminAuditService{repo: repo}
+}
+
+func (as *AdminAuditService) Record(ctx context.Context, entry AuditEntry) error {
+	return as.repo.Record(ctx, entry)
+}
+
+func (as *AdminAuditService) GetEntries(ctx context.Context, filter AuditFilter) (Page[AuditEntry], error) {
+	if err := validatePageParams(&filter.PageParams); err != nil {
+		return Page[AuditEntry]{}, err
+	}
+	return as.repo.GetAll(ctx, filter)
+}
+
+// Export streams every entry the filter matches to fn, the limit and the cursor don't apply
+func (as *AdminAuditService) Export(ctx context.Context, filter AuditFilter, fn func(AuditEntry) error) error {
+	filter.Limit, filter.Cursor = 0, ""
+	if err := validatePageParams(&filter.PageParams); err != nil {
+		return err
+	}
+	return as.repo.Export(ctx, filter, fn)
+}
+
+// auditChanges turns the states of a target before and after an action into the old and new values
+// of its entry. Only the fields that changed are kept, a target that was created or deleted is kept whole
+func auditChanges(before any, after any) (map[string]any, map[string]any, error) {
+	oldValue, err := auditValue(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	newValue, err := auditValue(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	if oldValue == nil || newValue == nil {
+		return oldValue, newValue, nil
+	}
+
+	for field, value := range oldValue {
+		if reflect.DeepEqual(value, newValue[field]) {
+			delete(oldValue, field)
+			delete(newValue, field)
+		}
+	}
+	return oldValue, newValue, nil
+}
+
+// auditValue is the JSON object of a target, as the API shows it
+func auditValue(state any) (map[string]any, error) {
+	if state == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	var value map[string]any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// /login hands out a short-lived access token together with a refresh token. The refresh token is
+// swapped for a new pair at /token/refresh and revoked at /logout, both are public routes
+
+// authErrorStatus tells rejected refresh tokens apart from failures of the token store
+func authErrorStatus(err error) int {
+	if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+func (s *Server) RefreshTokenHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	tokens, err := s.authSvc.Refresh(ctx, req.RefreshToken)
+	if err != nil {
+		log.Println("Error refreshing token: ", err)
+		http.Error(w, err.Error(), authErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, tokens)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// LogoutHTTP revokes the session of the refresh token, {"all": true} logs out of every device
+func (s *Server) LogoutHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+		All          bool   `json:"all"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	err := s.authSvc.Logout(ctx, req.RefreshToken, req.All)
+	if err != nil {
+		log.Println("Error logging out: ", err)
+		http.Error(w, err.Error(), authErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	response := map[string]any{
+		"status": "Logged out",
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// LoginTwoFactorHTTP completes a login that answered with mfa_required, with a TOTP code or a recovery code
+func (s *Server) LoginTwoFactorHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := s.authSvc.CompleteTwoFactor(ctx, req.ChallengeToken, req.Code, req.RecoveryCode)
+	if err != nil {
+		log.Println("Error completing two-factor login: ", err)
+		status := twoFactorErrorStatus(err)
+		if errors.Is(err, ErrInvalidChallenge) || errors.Is(err, ErrInvalidTwoFactorCode) {
+			status = http.StatusUnauthorized
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, result)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// JWKSHTTP publishes the public keys that verify access tokens, so other services don't need JWT_SECRET
+func (s *Server) JWKSHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	err := EncodeJSONhelper(w, map[string]any{"keys": s.keys.JWKS()})
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
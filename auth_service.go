@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// TokenPair is what logging in and refreshing return, Token is the short-lived JWT access token
+type TokenPair struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"` // when Token expires
+}
+
+type AuthService struct {
+	userSvc      *UserService
+	twoFactorSvc *TwoFactorService
+	throttleSvc  *LoginThrottleService
+	repo         RefreshTokenRepository
+	keys         *KeySet
+	accessTTL    time.Duration
+	refreshTTL   time.Duration
+}
+
+func NewAuthService(userSvc *UserService, twoFactorSvc *TwoFactorService, throttleSvc *LoginThrottleService, repo RefreshTokenRepository, keys *KeySet, accessTTL time.Duration, refreshTTL time.Duration) *AuthService {
+	return &AuthService{
+		userSvc:      userSvc,
+		twoFactorSvc: twoFactorSvc,
+		throttleSvc:  throttleSvc,
+		repo:         repo,
+		keys:         keys,
+		accessTTL:    accessTTL,
+		refreshTTL:   refreshTTL,
+	}
+}
+
+// LoginResult is what /login and /login/2fa return: tokens, or a challenge when the user has 2FA
+type LoginResult struct {
+	*TokenPair
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token,omitempty"` // for /login/2fa, valid TWO_FACTOR_CHALLENGE_TTL
+}
+
+// Login checks the credentials, users with 2FA get a challenge to complete with CompleteTwoFactor.
+// ip is the client's, failed logins are throttled per account and per ip
+func (as *AuthService) Login(ctx context.Context, name string, password string, ip string) (*LoginResult, error) {
+	userId, err := as.userSvc.ResolveLogin(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := as.throttleSvc.Check(ctx, userId, name, ip); err != nil {
+		return nil, err
+	}
+
+	user, err := as.userSvc.AuthenticateUser(ctx, name, password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		if err := as.throttleSvc.RecordFailure(ctx, userId, name, ip); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := as.throttleSvc.RecordSuccess(ctx, user.Id); err != nil {
+		return nil, err
+	}
+
+	enabled, err := as.twoFactorSvc.IsEnabled(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		challenge, err := as.keys.GenerateChallengeJWT(user.Id, user.TokenVersion, time.Now().Add(TWO_FACTOR_CHALLENGE_TTL))
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFARequired: true, ChallengeToken: challenge}, nil
+	}
+
+	tokens, err := as.startSession(ctx, user, false)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{TokenPair: tokens}, nil
+}
+
+// CompleteTwoFactor finishes a login with a TOTP code, or a recovery code when code is empty
+func (as *AuthService) CompleteTwoFactor(ctx context.Context, challenge string, code string, recoveryCode string) (*LoginResult, error) {
+	claims := &Claims{}
+	token, err := as.keys.Parse(challenge, claims, TOKEN_AUDIENCE_2FA)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidChallenge
+	}
+
+	user, err := as.userSvc.GetUserById(ctx, claims.UserID, claims.UserID, USER)
+	if err != nil {
+		return nil, err
+	}
+	// the password changed since the challenge was handed out
+	if user.TokenVersion != claims.TokenVersion {
+		return nil, ErrInvalidChallenge
+	}
+
+	switch {
+	case strings.TrimSpace(code) != "":
+		err = as.twoFactorSvc.VerifyCode(ctx, user.Id, code)
+	case strings.TrimSpace(recoveryCode) != "":
+		err = as.twoFactorSvc.VerifyRecoveryCode(ctx, user.Id, recoveryCode)
+	default:
+		err = ErrInvalidTwoFactorCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := as.startSession(ctx, user, true)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{TokenPair: tokens}, nil
+}
+
+// startSession starts a new refresh token family
+func (as *AuthService) startSession(ctx context.Context, user *User, mfa bool) (*TokenPair, error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	familyId, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = as.repo.Create(ctx, RefreshToken{
+		UserId:    user.Id,
+		FamilyId:  familyId,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(as.refreshTTL),
+		MFA:       mfa,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return as.tokenPair(user, mfa, refreshToken)
+}
+
+// Refresh swaps a refresh token for a new pair, the old refresh token can't be used again
+func (as *AuthService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	refreshToken = strings.TrimSpace(refreshToken)
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	next, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := as.repo.Rotate(ctx, hashToken(refreshToken), RefreshToken{
+		TokenHash: hashToken(next),
+		ExpiresAt: time.Now().Add(as.refreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the role and token version are read again, so the new access token reflects the latest changes
+	user, err := as.userSvc.GetUserById(ctx, old.UserId, old.UserId, USER)
+	if err != nil {
+		return nil, err
+	}
+
+	return as.tokenPair(user, old.MFA, next)
+}
+
+// Logout revokes the login session of the refresh token, or every session of its owner when all is set.
+// Access tokens already issued stay valid until they expire
+func (as *AuthService) Logout(ctx context.Context, refreshToken string, all bool) error {
+	refreshToken = strings.TrimSpace(refreshToken)
+	if refreshToken == "" {
+		return ErrInvalidRefreshToken
+	}
+
+	userId, err := as.repo.RevokeFamily(ctx, hashToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	if all {
+		return as.repo.RevokeAllForUser(ctx, userId)
+	}
+	return nil
+}
+
+// Impersonate returns an access token that acts as user on behalf of actor, valid IMPERSONATION_TTL.
+// Who may impersonate whom is checked by the caller
+func (as *AuthService) Impersonate(user *User, actor *Claims) (string, time.Time, error) {
+	expiresAt := time.Now().Add(IMPERSONATION_TTL)
+	impersonator := Impersonator{UserID: actor.UserID, Role: actor.Role, TokenVersion: actor.TokenVersion}
+	token, err := as.keys.GenerateImpersonationJWT(user, impersonator, expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+func (as *AuthService) tokenPair(user *User, mfa bool, refreshToken string) (*TokenPair, error) {
+	expiresAt := time.Now().Add(as.accessTTL)
+	token, err := as.keys.GenerateJWT(user.Id, user.Role, user.TokenVersion, mfa, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{Token: token, RefreshToken: refreshToken, ExpiresAt: expiresAt}, nil
+}
+
+// randomToken returns 32 random bytes, base64url encoded
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how refresh tokens are looked up, the tokens are random enough for a plain sha256
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
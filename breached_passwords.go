@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// known breached passwords are kept in a bloom filter of their SHA-1, so even a list of millions
+// takes a few bytes per password. A bloom filter can report a password that is not on the list
+// (about 1 in 1000), never the other way round
+
+//go:embed breached_passwords.txt
+var commonPasswords string
+
+// bloomFilter is a fixed size bloom filter over SHA-1 digests, the digest is already uniform so
+// its first two words make the k bit positions by double hashing
+type bloomFilter struct {
+	bits []uint64
+	m    uint64 // number of bits
+	k    uint64 // bits set per entry
+}
+
+// newBloomFilter sizes a filter for n entries with a false positive rate of about 0.1%
+func newBloomFilter(n int) *bloomFilter {
+	m := uint64(math.Ceil(-float64(max(n, 1)) * math.Log(0.001) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: 10}
+}
+
+func (bf *bloomFilter) positions(digest [sha1.Size]byte, fn func(bit uint64)) {
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16]) | 1
+	for i := uint64(0); i < bf.k; i++ {
+		fn((h1 + i*h2) % bf.m)
+	}
+}
+
+func (bf *bloomFilter) add(digest [sha1.Size]byte) {
+	bf.positions(digest, func(bit uint64) { bf.bits[bit/64] |= 1 << (bit % 64) })
+}
+
+func (bf *bloomFilter) contains(digest [sha1.Size]byte) bool {
+	found := true
+	bf.positions(digest, func(bit uint64) {
+		if bf.bits[bit/64]&(1<<(bit%64)) == 0 {
+			found = false
+		}
+	})
+	return found
+}
+
+// breachedDigest reads one line of a list, a password as is or the hex SHA-1 of one like in the
+// Have I Been Pwned downloads, where a :count may follow the hash
+func breachedDigest(line string) ([sha1.Size]byte, bool) {
+	line = strings.TrimRight(line, "\r")
+	if line == "" {
+		return [sha1.Size]byte{}, false
+	}
+	hash, _, _ := strings.Cut(line, ":")
+	if len(hash) == 2*sha1.Size {
+		var digest [sha1.Size]byte
+		if _, err := hex.Decode(digest[:], []byte(hash)); err == nil {
+			return digest, true
+		}
+	}
+	return sha1.Sum([]byte(line)), true
+}
+
+// loadBreachedPasswords builds the filter from the built-in list of common passwords and, if path
+// is not empty, the list in that file, one password or SHA-1 per line
+func loadBreachedPasswords(path string) (*bloomFilter, error) {
+	builtin := strings.Split(strings.TrimSpace(commonPasswords), "\n")
+	n := len(builtin)
+
+	var f *os.File
+	if path != "" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		// counted first, the filter can't grow
+		if err := eachLine(f, func(string) { n++ }); err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	bf := newBloomFilter(n)
+	add := func(line string) {
+		if digest, ok := breachedDigest(line); ok {
+			bf.add(digest)
+		}
+	}
+	for _, line := range builtin {
+		add(line)
+	}
+	if f != nil {
+		if err := eachLine(f, add); err != nil {
+			return nil, err
+		}
+	}
+	return bf, nil
+}
+
+func eachLine(r io.Reader, fn func(line string)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fn(scanner.Text())
+	}
+	return scanner.Err()
+}
@@ -1,31 +1,288 @@
 package main
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // TODO : ADD MORE ERRORS (mainly for repositories and where you see 'id must be > 0' or smth like that, just add it here)
 // TODO : ADD MORE CONSTS (such as DB_URL, PORT, etc)
 
 const (
 	DB_URL_KEY = "DB_URL" // Key for DB_URL env var, value is being set in database.env
-	ADMIN      = "admin"  // AdminUsers role
-	USER       = "user"   // User role
+	ADMIN      = "admin"  // built-in role with every permission
+	USER       = "user"   // built-in role without permissions, the default
+
+	DUE_OVERDUE = "overdue" // tasks whose due date has passed and which are still open
+	DUE_TODAY   = "today"   // tasks due today in the requested timezone
+	DUE_WEEK    = "week"    // tasks due this week (monday to sunday) in the requested timezone
+
+	// task priorities, the order matches the task_priority enum in the db, so ORDER BY priority works
+	PRIORITY_NONE   = "none"
+	PRIORITY_LOW    = "low"
+	PRIORITY_MEDIUM = "medium"
+	PRIORITY_HIGH   = "high"
+	PRIORITY_URGENT = "urgent"
+
+	SORT_ID       = "id"       // oldest first, the same as no sort
+	SORT_PRIORITY = "priority" // most important first, then the closest due date
+	SORT_DUE      = "due"      // closest due date first, then the most important
+	SORT_CREATED  = "created"  // newest first
+	SORT_UPDATED  = "updated"  // most recently updated first
+	SORT_TITLE    = "title"    // tasks alphabetically
+	SORT_DELETED  = "deleted"  // most recently deleted first, the default in the trash
+	SORT_NAME     = "name"     // users alphabetically
+
+	ORDER_ASC  = "asc"
+	ORDER_DESC = "desc"
+
+	DEFAULT_PAGE_LIMIT = 50  // page size when ?limit is not given
+	MAX_PAGE_LIMIT     = 200 // largest accepted ?limit
+
+	// task event fields besides the tasks columns
+	EVENT_CREATED = "created" // new_value is the title the task was created with
+	EVENT_LABEL   = "label"   // a label was attached (new_value) or detached (old_value)
+	EVENT_ITEM    = "item"    // a checklist item before (old_value) and after (new_value) the change, as JSON
+
+	DEFAULT_TRASH_RETENTION      = 30 * 24 * time.Hour // tasks older than this in the trash are purged, TRASH_RETENTION overrides it
+	DEFAULT_TRASH_PURGE_INTERVAL = time.Hour           // how often the trash is purged, TRASH_PURGE_INTERVAL overrides it
+
+	DEFAULT_ACCESS_TOKEN_TTL  = 15 * time.Minute    // lifetime of a JWT access token, ACCESS_TOKEN_TTL overrides it
+	DEFAULT_REFRESH_TOKEN_TTL = 30 * 24 * time.Hour // lifetime of a refresh token, REFRESH_TOKEN_TTL overrides it
+	TOKEN_VERSION_CACHE_TTL   = 30 * time.Second    // how long JWTmiddleware trusts a cached token version
+	IMPERSONATION_TTL         = 10 * time.Minute    // lifetime of an impersonation token, it can't be refreshed
+	IMPERSONATION_HEADER      = "X-Impersonated-By" // set to the impersonator's id on every response to an impersonation token
+
+	PAT_PREFIX          = "tdl_pat_"          // personal access tokens start with it, JWTmiddleware tells them apart from JWTs by it
+	DEFAULT_PAT_TTL     = 30 * 24 * time.Hour // lifetime of a personal access token created without expires_at
+	MAX_PAT_TTL         = 365 * 24 * time.Hour
+	MAX_PAT_NAME_LEN    = 64          // matches personal_access_tokens.name VARCHAR(64)
+	PAT_LAST_USED_DELAY = time.Minute // last_used_at is written at most this often per token
+
+	// personal access token scopes are a resource and an access level, GET requests need :read, the rest :write
+	SCOPE_TASKS    = "tasks" // tasks, their checklists, labels on tasks and the trash
+	SCOPE_LABELS   = "labels"
+	SCOPE_PROJECTS = "projects"
+	SCOPE_PROFILE  = "profile" // the user's own account, except password and deletion
+	SCOPE_ADMIN    = "admin"   // the /admin routes, only useful for admins
+	SCOPE_READ     = "read"
+	SCOPE_WRITE    = "write"
+
+	TOTP_ISSUER              = "TODO List" // shown next to the account in authenticator apps
+	TOTP_DIGITS              = 6
+	TOTP_PERIOD              = 30 * time.Second
+	RECOVERY_CODE_COUNT      = 10
+	TWO_FACTOR_CHALLENGE_TTL = 5 * time.Minute  // how long a login waits for the second factor
+	TWO_FACTOR_MAX_ATTEMPTS  = 5                // wrong codes in a row before the second factor is locked
+	TWO_FACTOR_LOCKOUT       = 15 * time.Minute // how long it stays locked
+	TOKEN_AUDIENCE_ACCESS    = "api"            // aud of access tokens, the only audience JWTmiddleware accepts
+	TOKEN_AUDIENCE_2FA       = "2fa"            // aud of login challenge tokens
+
+	SETTING_REQUIRE_ADMIN_2FA = "require_admin_2fa" // app_settings key, "true" keeps admins without 2FA out of /admin
+	SETTINGS_CACHE_TTL        = 30 * time.Second    // how long app settings are cached in memory
+
+	// failed logins are counted per account and per client IP. Past the free attempts every failure
+	// doubles the wait before the next try, past the lockout threshold the key is locked for LOGIN_LOCKOUT
+	THROTTLE_USER            = "user" // key is the id of the account the login resolved to
+	THROTTLE_NAME            = "name" // key is the name as typed, for logins that match no account
+	THROTTLE_IP              = "ip"
+	LOGIN_FAILURE_WINDOW     = time.Hour // failures older than this are forgotten
+	LOGIN_FREE_ATTEMPTS_USER = 3
+	LOGIN_FREE_ATTEMPTS_IP   = 20 // higher, many users can share an IP behind a NAT
+	LOGIN_LOCKOUT_USER       = 10
+	LOGIN_LOCKOUT_IP         = 50
+	LOGIN_BASE_DELAY         = time.Second
+	LOGIN_LOCKOUT            = 15 * time.Minute
+
+	PASSWORD_RESET_TTL          = time.Hour   // how long a password reset token can be used
+	PASSWORD_RESET_RESEND_DELAY = time.Minute // a user gets at most one reset token this often
+
+	// password hashing, PASSWORD_HASH picks the algorithm for new hashes. The argon2id defaults are the
+	// OWASP minimum, small enough for a 1 GB machine
+	PASSWORD_HASH_ARGON2ID     = "argon2id"
+	PASSWORD_HASH_BCRYPT       = "bcrypt"
+	DEFAULT_ARGON2_MEMORY      = 19 * 1024 // KiB
+	DEFAULT_ARGON2_ITERATIONS  = 2
+	DEFAULT_ARGON2_PARALLELISM = 1
+	ARGON2_SALT_LEN            = 16
+	ARGON2_KEY_LEN             = 32
+
+	DEFAULT_PASSWORD_MIN_LENGTH = 8
+	DEFAULT_PASSWORD_MAX_LENGTH = 128
+	MAX_PASSWORD_LENGTH         = 1024 // highest PASSWORD_MAX_LENGTH, hashing longer input only costs time
+
+	// character classes PASSWORD_REQUIRED_CLASSES can require
+	PASSWORD_CLASS_LOWER  = "lower"
+	PASSWORD_CLASS_UPPER  = "upper"
+	PASSWORD_CLASS_DIGIT  = "digit"
+	PASSWORD_CLASS_SYMBOL = "symbol" // anything but letters and digits, spaces too
+
+	EMAIL_VERIFICATION_TTL      = 24 * time.Hour // how long a verification link works
+	TOKEN_AUDIENCE_VERIFY_EMAIL = "verify_email" // aud of email verification tokens
+	MAX_EMAIL_LEN               = 254
+
+	// notifier backends, NOTIFIER picks one
+	NOTIFIER_LOG          = "log"  // writes messages to the server log, for local dev
+	NOTIFIER_FILE         = "file" // appends messages to NOTIFIER_FILE, for local dev
+	NOTIFIER_SMTP         = "smtp"
+	DEFAULT_NOTIFIER_FILE = "notifications.log"
+	DEFAULT_SMTP_PORT     = "587"
+
+	// permissions a role can be granted, they match the permissions table. The *_all ones open the
+	// data of other users to the repository predicates, see permits
+	PERM_USERS_READ        = "users.read"
+	PERM_USERS_CREATE      = "users.create"
+	PERM_USERS_UPDATE      = "users.update" // rename, password, email and 2FA reset of other users
+	PERM_USERS_DELETE      = "users.delete"
+	PERM_USERS_IMPERSONATE = "users.impersonate" // acting as another user through /me, see ImpersonateUserHTTP
+	PERM_ROLES_READ        = "roles.read"
+	PERM_ROLES_MANAGE      = "roles.manage"    // editing roles and assigning them to users
+	PERM_TASKS_READ_ALL    = "tasks.read_all"  // tasks, checklists, labels and projects of every user
+	PERM_TASKS_WRITE_ALL   = "tasks.write_all" // the same, for changes
+	PERM_LOCKOUTS_READ     = "lockouts.read"
+	PERM_LOCKOUTS_CLEAR    = "lockouts.clear"
+	PERM_SETTINGS_READ     = "settings.read"
+	PERM_SETTINGS_UPDATE   = "settings.update"
+	PERM_AUDIT_READ        = "audit.read"
+	ROLE_CACHE_TTL         = 30 * time.Second // how long the permissions of a role are cached in memory
+
+	// admin_audit_log actions are the target type and what was done to it
+	AUDIT_TARGET_USER                    = "user"
+	AUDIT_TARGET_TASK                    = "task"
+	AUDIT_TARGET_ROLE                    = "role"
+	AUDIT_TARGET_LOCKOUT                 = "lockout" // the id is kind:key
+	AUDIT_TARGET_SETTINGS                = "settings"
+	AUDIT_ACTION_USER_CREATE             = "user.create"
+	AUDIT_ACTION_USER_RENAME             = "user.rename"
+	AUDIT_ACTION_USER_PASSWORD           = "user.password"
+	AUDIT_ACTION_USER_ROLE               = "user.role"
+	AUDIT_ACTION_USER_EMAIL              = "user.email"
+	AUDIT_ACTION_USER_2FA_RESET          = "user.2fa_reset"
+	AUDIT_ACTION_USER_DELETE             = "user.delete"
+	AUDIT_ACTION_USER_IMPERSONATE        = "user.impersonate"
+	AUDIT_ACTION_USER_IMPERSONATED_WRITE = "user.impersonated_write" // a change made with an impersonation token
+	AUDIT_ACTION_TASK_CREATE             = "task.create"
+	AUDIT_ACTION_TASK_DELETE             = "task.delete"
+	AUDIT_ACTION_TASK_TITLE              = "task.title"
+	AUDIT_ACTION_TASK_DESCRIPTION        = "task.description"
+	AUDIT_ACTION_TASK_STATUS             = "task.status"
+	AUDIT_ACTION_TASK_PRIORITY           = "task.priority"
+	AUDIT_ACTION_TASK_DUE                = "task.due"
+	AUDIT_ACTION_TASK_RECURRENCE         = "task.recurrence"
+	AUDIT_ACTION_TASK_ITEMS              = "task.items" // any change to the checklist of the task
+	AUDIT_ACTION_LOCKOUT_CLEAR           = "lockout.clear"
+	AUDIT_ACTION_SETTINGS_UPDATE         = "settings.update"
+	AUDIT_ACTION_ROLE_CREATE             = "role.create"
+	AUDIT_ACTION_ROLE_UPDATE             = "role.update"
+	AUDIT_ACTION_ROLE_DELETE             = "role.delete"
+
+	DEFAULT_COLOR      = "#9e9e9e" // grey, used when a label or a project is created without a color
+	MAX_LABEL_NAME_LEN = 64        // matches labels.name VARCHAR(64)
 )
 
 var (
-	ErrDBisNotSet            = errors.New(DB_URL_KEY + " is not set")                                // Error returned when DB_URL is not set, check env vars
-	ErrIdMustBeGtZero        = errors.New("id must be greater than 0")                               // Error returned when id is not greater than 0
-	ErrLenNameIsZero         = errors.New("the length of name must be greater than 0")               // Error returned when len(name) is 0
-	ErrPasswordMustBeGt6     = errors.New("the length of a password must be greater than 6 symbols") //
-	ErrOldPasswordIsWrong    = errors.New("old password is incorrect")                               // When the old password is incorrect
-	ErrNewPasswordIsSame     = errors.New("new password must be different from old password")        // When the new password is the same as the old password
-	ErrUserNotFound          = errors.New("user not found")                                          // When user with this id does not exist
-	ErrEmptyTitle            = errors.New("title must be not empty")                                 // When a title is empty
-	ErrNoUserWithThisId      = errors.New("user with this id does not exist")                        // When user with this id does not exist
-	ErrTaskDescNotUpdated    = errors.New("task's description was not updated")                      // when description was not updated due to a 'no rows affected' error
-	ErrTaskStatusNotSwitched = errors.New("task's status was not switched")                          // when task status was not switched due to a 'no rows affected' error
-	ErrTaskTitleNotUpdated   = errors.New("task's title was not updated")                            // when a task title was not updated due to a 'no rows affected' error
-	ErrSwitchRole            = errors.New("errors switching user's role")                            // when a user's role was not switched'
-	ErrTokenNotSet           = errors.New("JWT_SECRET is not set")                                   // when JWT_SECRET is not set in the .env file
-	ErrInvalidName           = errors.New("invalid name")
-	ErrInvalidPassword       = errors.New("invalid password")
+	ErrDBisNotSet                     = errors.New(DB_URL_KEY + " is not set")                                // Error returned when DB_URL is not set, check env vars
+	ErrIdMustBeGtZero                 = errors.New("id must be greater than 0")                               // Error returned when id is not greater than 0
+	ErrLenNameIsZero                  = errors.New("the length of name must be greater than 0")               // Error returned when len(name) is 0
+	ErrPasswordMustBeGt6              = errors.New("the length of a password must be greater than 6 symbols") //
+	ErrOldPasswordIsWrong             = errors.New("old password is incorrect")                               // When the old password is incorrect
+	ErrNewPasswordIsSame              = errors.New("new password must be different from old password")        // When the new password is the same as the old password
+	ErrUserNotFound                   = errors.New("user not found")                                          // When user with this id does not exist
+	ErrEmptyTitle                     = errors.New("title must be not empty")                                 // When a title is empty
+	ErrNoUserWithThisId               = errors.New("user with this id does not exist")                        // When user with this id does not exist
+	ErrTaskDescNotUpdated             = errors.New("task's description was not updated")                      // when description was not updated due to a 'no rows affected' error
+	ErrTaskStatusNotSwitched          = errors.New("task's status was not switched")                          // when task status was not switched due to a 'no rows affected' error
+	ErrTaskTitleNotUpdated            = errors.New("task's title was not updated")                            // when a task title was not updated due to a 'no rows affected' error
+	ErrTokenNotSet                    = errors.New("JWT_SECRET is not set")                                   // when JWT_SECRET is not set in the .env file
+	ErrInvalidName                    = errors.New("invalid name")
+	ErrInvalidPassword                = errors.New("invalid password")
+	ErrInvalidDueFilter               = errors.New("due must be one of: overdue, today, week")                                                                                           // when the due query param is unknown
+	ErrInvalidTimezone                = errors.New("invalid timezone")                                                                                                                   // when the tz query param is not an IANA timezone
+	ErrTaskDueDateNotUpdated          = errors.New("task's due date was not updated")                                                                                                    // when a task due date was not updated due to a 'no rows affected' error
+	ErrInvalidPriority                = errors.New("priority must be one of: none, low, medium, high, urgent")                                                                           // when a priority is not a task_priority value
+	ErrTaskPriorityNotUpdated         = errors.New("task's priority was not updated")                                                                                                    // when a task priority was not updated due to a 'no rows affected' error
+	ErrInvalidSort                    = errors.New("sort must be one of: id, priority, due, created, updated, title, deleted")                                                           // when the sort query param is unknown
+	ErrLabelNotFound                  = errors.New("label not found")                                                                                                                    // when a label does not exist or belongs to someone else
+	ErrEmptyLabelName                 = errors.New("label name must be not empty")                                                                                                       // when a label name is blank
+	ErrLabelNameTooLong               = errors.New("label name must be at most 64 symbols")                                                                                              // when a label name does not fit labels.name
+	ErrLabelNameTaken                 = errors.New("label with this name already exists")                                                                                                // when (user_id, name) is not unique
+	ErrInvalidColor                   = errors.New("color must be a hex color like #ff8800")                                                                                             // when a label color is not #rrggbb
+	ErrLabelNotAttached               = errors.New("label was not attached, task or label not found")                                                                                    // when the task and the label are not owned by the same user
+	ErrLabelNotDetached               = errors.New("label was not detached, it is not attached to this task")                                                                            // when detaching a label that is not on the task
+	ErrInvalidLabelFilter             = errors.New("labels must be a comma separated list of label ids")                                                                                 // when the labels query param is malformed
+	ErrTaskNotFound                   = errors.New("task not found")                                                                                                                     // when a task does not exist or belongs to someone else
+	ErrTaskItemNotFound               = errors.New("checklist item not found")                                                                                                           // when an item does not exist on this task or the task belongs to someone else
+	ErrInvalidPosition                = errors.New("position must be 0 or greater")                                                                                                      // when moving a checklist item to a negative position
+	ErrProjectNotFound                = errors.New("project not found")                                                                                                                  // when a project does not exist or belongs to someone else
+	ErrEmptyProjectName               = errors.New("project name must be not empty")                                                                                                     // when a project name is blank
+	ErrInvalidReassign                = errors.New("reassign_to must be another project id or none")                                                                                     // when the reassign_to query param is malformed or points at the deleted project
+	ErrInvalidProjectFilter           = errors.New("project must be a project id")                                                                                                       // when the project query param is malformed
+	ErrInvalidRecurrence              = errors.New("recurrence must be an RRULE like FREQ=WEEKLY;INTERVAL=1;BYDAY=MO,WE")                                                                // when a recurrence rule can't be parsed or uses unsupported parts
+	ErrTaskRecurrenceNotUpdated       = errors.New("task's recurrence was not updated")                                                                                                  // when a task recurrence was not updated due to a 'no rows affected' error
+	ErrInvalidUserSort                = errors.New("sort must be one of: id, name, created, updated")                                                                                    // when the sort query param of the user listing is unknown
+	ErrInvalidOrder                   = errors.New("order must be asc or desc")                                                                                                          // when the order query param is unknown
+	ErrInvalidLimit                   = errors.New("limit must be between 1 and 200")                                                                                                    // when the limit query param is not a number or out of range
+	ErrInvalidCursor                  = errors.New("invalid cursor")                                                                                                                     // when a cursor was tampered with or belongs to another sort or order
+	ErrInvalidTimeFilter              = errors.New("created_after and updated_before must be RFC 3339 timestamps")                                                                       // when a time filter can't be parsed
+	ErrInvalidCompletedFilter         = errors.New("completed must be true or false")                                                                                                    // when the completed query param is not a bool
+	ErrEmptySearchQuery               = errors.New("search query q must be not empty")                                                                                                   // when searching with a blank q
+	ErrInvalidSearchSort              = errors.New("search results are always sorted by relevance")                                                                                      // when a sort is given for a search
+	ErrTaskNotInTrash                 = errors.New("task not found in the trash")                                                                                                        // when restoring or deleting for good a task that is not in the trash
+	ErrInvalidTrashConfig             = errors.New("TRASH_RETENTION and TRASH_PURGE_INTERVAL must be positive durations like 720h")                                                      // when the trash purge env vars can't be parsed
+	ErrTaskNotDeleted                 = errors.New("task not deleted")                                                                                                                   // when deleting a task that does not exist, belongs to someone else or is already in the trash
+	ErrInvalidRefreshToken            = errors.New("invalid or expired refresh token")                                                                                                   // when a refresh token is unknown, expired or revoked
+	ErrRefreshTokenReused             = errors.New("refresh token was already used, please log in again")                                                                                // when a rotated refresh token is presented again, its whole family gets revoked
+	ErrInvalidTokenTTL                = errors.New("ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL must be positive durations like 15m")                                                         // when the token lifetime env vars can't be parsed
+	ErrInvalidJWTKey                  = errors.New("JWT keys must be Ed25519 or RSA (2048 bits or more) PEM files")                                                                      // when a file in JWT_KEYS_DIR can't be used as a signing key
+	ErrInvalidJWTKeyConfig            = errors.New("JWT_ACTIVE_KID must name a private key in JWT_KEYS_DIR and every other key must be listed in JWT_RETIRED_KEYS as kid=RFC 3339 time") // when the keyset env vars don't match the keys dir
+	ErrUnknownJWTKey                  = errors.New("token was signed with an unknown or retired key")                                                                                    // when a token's kid is not in the keyset or its key no longer verifies
+	ErrPersonalAccessTokenNotFound    = errors.New("personal access token not found")                                                                                                    // when a token does not exist or belongs to someone else
+	ErrInvalidPersonalAccessToken     = errors.New("invalid or expired personal access token")                                                                                           // when a tdl_pat_ bearer token is unknown or expired
+	ErrEmptyPersonalAccessTokenName   = errors.New("token name must be not empty")                                                                                                       // when a token name is blank
+	ErrPersonalAccessTokenNameTooLong = errors.New("token name must be at most 64 symbols")                                                                                              // when a token name does not fit personal_access_tokens.name
+	ErrPersonalAccessTokenNameTaken   = errors.New("token with this name already exists")                                                                                                // when (user_id, name) is not unique
+	ErrInvalidScope                   = errors.New("scopes must be one or more of: tasks, labels, projects, profile, admin followed by :read or :write")                                 // when a scope is unknown
+	ErrInvalidTokenExpiry             = errors.New("expires_at must be in the future and at most a year away")                                                                           // when a token expiry is out of range
+	ErrInsufficientScope              = errors.New("personal access token lacks the scope for this request")                                                                             // when a token's scopes don't cover the route
+	ErrSessionRequired                = errors.New("personal access tokens can't be used here, log in instead")                                                                          // when a token is used on the password, account deletion or token routes
+	ErrTwoFactorNotEnrolled           = errors.New("two-factor authentication is not set up, start at /me/2fa/enroll")                                                                   // when confirming or using 2FA without an enrollment
+	ErrTwoFactorAlreadyEnabled        = errors.New("two-factor authentication is already enabled")                                                                                       // when enrolling again without disabling first
+	ErrInvalidTwoFactorCode           = errors.New("invalid two-factor code")                                                                                                            // when a TOTP or recovery code is wrong or was already used
+	ErrTwoFactorLocked                = errors.New("too many wrong two-factor codes, try again later")                                                                                   // when TWO_FACTOR_MAX_ATTEMPTS wrong codes in a row locked the second factor
+	ErrInvalidChallenge               = errors.New("invalid or expired login challenge, log in again")                                                                                   // when /login/2fa gets a token that is not a live challenge
+	ErrTwoFactorRequired              = errors.New("admins must use two-factor authentication, set it up at /me/2fa and log in again")                                                   // when an admin session without 2FA hits /admin while it is required
+	ErrTwoFactorStillRequired         = errors.New("admins can't disable two-factor authentication while it is required")                                                                // when an admin disables 2FA while require_admin_2fa is on
+	ErrInvalidCredentials             = errors.New("invalid name or password")                                                                                                           // when logging in with an unknown name or a wrong password, the two are not told apart
+	ErrTooManyLoginAttempts           = errors.New("too many failed logins, try again later")                                                                                            // when the username or the client IP is throttled
+	ErrInvalidThrottleKind            = errors.New("lockout kind must be users or ips")                                                                                                  // when clearing a lockout of an unknown kind
+	ErrLockoutNotFound                = errors.New("lockout not found")                                                                                                                  // when clearing a username or IP without failed logins
+	ErrInvalidResetToken              = errors.New("invalid or expired password reset token, request a new one")                                                                         // when a reset token is unknown, used or expired
+	ErrPasswordResetTooSoon           = errors.New("a password reset was requested moments ago")                                                                                         // when a user asks for another reset within PASSWORD_RESET_RESEND_DELAY
+	ErrInvalidNotifierConfig          = errors.New("NOTIFIER must be log, file or smtp, smtp needs SMTP_HOST and SMTP_FROM")                                                             // when the notifier env vars are wrong
+	ErrNoRecipient                    = errors.New("the user has no address to send to")                                                                                                 // when a message's recipient is not an email address
+	ErrInvalidEmail                   = errors.New("invalid email address")                                                                                                              // when an email is not a plain address like alice@example.com
+	ErrEmailTaken                     = errors.New("this email is already used by another account")                                                                                      // when another account has verified the email
+	ErrNoEmail                        = errors.New("the account has no email address")                                                                                                   // when asking for a verification link without an email
+	ErrEmailAlreadyVerified           = errors.New("the email address is already verified")                                                                                              // when asking for a verification link again after verifying
+	ErrInvalidVerificationToken       = errors.New("invalid or expired verification link, request a new one")                                                                            // when a verification token is bad, expired or for an address the user no longer has
+	ErrInvalidPasswordHash            = errors.New("stored password hash is malformed")                                                                                                  // when a users.password value is neither a PHC argon2id string nor a bcrypt hash
+	ErrInvalidPasswordHashConfig      = errors.New("PASSWORD_HASH must be argon2id or bcrypt, and the ARGON2_* and BCRYPT_COST values in range")                                         // when the password hashing env vars are wrong
+	ErrWeakPassword                   = errors.New("password does not meet the password policy")                                                                                         // wrapped with what to fix when a new password fails PasswordPolicy.Validate
+	ErrInvalidPasswordPolicyConfig    = errors.New("PASSWORD_MIN_LENGTH and PASSWORD_MAX_LENGTH must be in range and PASSWORD_REQUIRED_CLASSES a list of lower, upper, digit, symbol")   // when the password policy env vars are wrong
+	ErrRoleNotFound                   = errors.New("role not found")                                                                                                                     // when a role does not exist
+	ErrRoleExists                     = errors.New("role with this name already exists")                                                                                                 // when creating a role whose name is taken
+	ErrRoleInUse                      = errors.New("role is assigned to users, give them another role first")                                                                            // when deleting a role users still have
+	ErrBuiltinRole                    = errors.New("the user and admin roles can't be changed or deleted")                                                                               // when editing a built-in role
+	ErrInvalidRoleName                = errors.New("role name must be 1 to 32 lower-case letters, digits, - or _ and start with a letter")                                               // when a role name doesn't match roles.name
+	ErrInvalidPermission              = errors.New("unknown permission")                                                                                                                 // when a role is given a permission that doesn't exist
+	ErrPermissionDenied               = errors.New("your role lacks the permission for this request")                                                                                    // when RequirePermission turns a request away
+	ErrRoleTooPowerful                = errors.New("you can't manage a user or role with permissions you don't have")                                                                    // when a support-like role acts on someone above it
+	ErrLastAdmin                      = errors.New("the last admin can't lose the admin role or be deleted")                                                                             // when demoting or deleting the only user with the admin role
+	ErrRoleChangeNotConfirmed         = errors.New("changing your own role can lock you out of /admin, send \"confirm\": true to do it anyway")                                          // when an actor changes their own role without confirming
+	ErrInvalidAuditFilter             = errors.New("actor_id must be a positive integer, created_after and created_before RFC 3339 timestamps")                                          // when a filter of the audit log can't be parsed
+	ErrInvalidAuditSort               = errors.New("the audit log is always sorted by time")                                                                                             // when a sort is given for the audit log
+	ErrImpersonateSelf                = errors.New("you can't impersonate yourself")                                                                                                     // when an actor asks for an impersonation token for their own account
+	ErrImpersonating                  = errors.New("impersonation tokens can't be used here")                                                                                            // when an impersonation token is used on /admin or the credential routes
+	ErrReassignArchived               = errors.New("cannot move tasks into an archived project")                                                                                         // when reassign_to points at an archived project
+	ErrNameIsEmail                    = errors.New("name must not contain @")                                                                                                            // when a name could be taken for another user's email at login
 )
@@ -0,0 +1,136 @@
+package main
+
+import "time"
+
+// the API reads and writes these types, never the storage models of models.go. A column added to a
+// model stays internal until it is added here, and fields like the password hash have no way out
+
+// CreateUserRequest is the body of /sign-up and POST /admin/users
+type CreateUserRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// CreateTaskRequest is the body of POST /me/tasks and POST /admin/users/{id}/tasks
+type CreateTaskRequest struct {
+	ProjectId   *int       `json:"project_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	DueDate     *time.Time `json:"due_date"`
+	Priority    string     `json:"priority"`
+	Recurrence  *string    `json:"recurrence"`
+}
+
+type UserResponse struct {
+	Id              int        `json:"id"`
+	Name            string     `json:"name"`
+	Role            string     `json:"role"`
+	Email           *string    `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func newUserResponse(u *User) UserResponse {
+	return UserResponse{
+		Id:              u.Id,
+		Name:            u.Name,
+		Role:            u.Role,
+		Email:           u.Email,
+		EmailVerifiedAt: u.EmailVerifiedAt,
+		CreatedAt:       u.CreatedAt,
+		UpdatedAt:       u.UpdatedAt,
+	}
+}
+
+type TaskResponse struct {
+	Id          int             `json:"id"`
+	UserId      int             `json:"user_id"`
+	ProjectId   *int            `json:"project_id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	IsCompleted bool            `json:"is_completed"`
+	DueDate     *time.Time      `json:"due_date"`
+	Priority    string          `json:"priority"`
+	Recurrence  *string         `json:"recurrence"`
+	Labels      []LabelResponse `json:"labels"`
+	ItemsTotal  int             `json:"items_total"`
+	ItemsDone   int             `json:"items_done"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	DeletedAt   *time.Time      `json:"deleted_at"`
+}
+
+func newTaskResponse(t *Task) TaskResponse {
+	return TaskResponse{
+		Id:          t.Id,
+		UserId:      t.UserId,
+		ProjectId:   t.ProjectId,
+		Title:       t.Title,
+		Description: t.Description,
+		IsCompleted: t.IsCompleted,
+		DueDate:     t.DueDate,
+		Priority:    t.Priority,
+		Recurrence:  t.Recurrence,
+		Labels:      newLabelResponses(t.Labels),
+		ItemsTotal:  t.ItemsTotal,
+		ItemsDone:   t.ItemsDone,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+		DeletedAt:   t.DeletedAt,
+	}
+}
+
+type LabelResponse struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newLabelResponse(l *Label) LabelResponse {
+	return LabelResponse{
+		Id:        l.Id,
+		UserId:    l.UserId,
+		Name:      l.Name,
+		Color:     l.Color,
+		CreatedAt: l.CreatedAt,
+		UpdatedAt: l.UpdatedAt,
+	}
+}
+
+// newLabelResponses keeps an empty list empty instead of null
+func newLabelResponses(labels []Label) []LabelResponse {
+	responses := make([]LabelResponse, len(labels))
+	for i := range labels {
+		responses[i] = newLabelResponse(&labels[i])
+	}
+	return responses
+}
+
+type TaskSearchResultResponse struct {
+	TaskResponse
+	Rank           float32 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+func newTaskSearchResultResponse(r *TaskSearchResult) TaskSearchResultResponse {
+	return TaskSearchResultResponse{
+		TaskResponse:   newTaskResponse(&r.Task),
+		Rank:           r.Rank,
+		TitleHighlight: r.TitleHighlight,
+		Snippet:        r.Snippet,
+	}
+}
+
+// mapPage converts the items of a page, the cursor stays the same
+func mapPage[T any, R any](page Page[T], fn func(*T) R) Page[R] {
+	items := make([]R, len(page.Items))
+	for i := range page.Items {
+		items[i] = fn(&page.Items[i])
+	}
+	return Page[R]{Items: items, NextCursor: page.NextCursor}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// users set their email at /me/email, the verification link sent to it leads to /email/verify
+
+// emailErrorStatus maps the email errors a user can fix to their status codes
+func emailErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidEmail), errors.Is(err, ErrNoEmail), errors.Is(err, ErrEmailAlreadyVerified),
+		errors.Is(err, ErrInvalidVerificationToken), errors.Is(err, ErrIdMustBeGtZero):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrEmailTaken):
+		return http.StatusConflict
+	case errors.Is(err, ErrUserNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// ChangeEmailHTTP sets the email and sends a verification link, {"email": ""} removes it
+func (s *Server) ChangeEmailHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetUserId, ok := ctx.Value(targetIdContextKey).(int)
+	if !ok {
+		log.Println("Error getting target user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	err := s.emailSvc.ChangeEmail(ctx, targetUserId, input.Email, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error changing email: ", err)
+		http.Error(w, err.Error(), emailErrorStatus(err))
+		return
+	}
+
+	user, err := s.userSvc.GetUserById(ctx, targetUserId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting user by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, newUserResponse(user))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) ResendEmailVerificationHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetUserId, ok := ctx.Value(targetIdContextKey).(int)
+	if !ok {
+		log.Println("Error getting target user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := s.emailSvc.ResendVerification(ctx, targetUserId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error resending email verification: ", err)
+		http.Error(w, err.Error(), emailErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusAccepted)
+
+	response := map[string]any{
+		"status": "Verification link sent",
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// VerifyEmailHTTP is public, the token is proof enough
+func (s *Server) VerifyEmailHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	err := s.emailSvc.VerifyEmail(ctx, req.Token)
+	if err != nil {
+		log.Println("Error verifying email: ", err)
+		http.Error(w, err.Error(), emailErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	response := map[string]any{
+		"status": "Email verified",
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
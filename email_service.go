@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// EmailService manages the email addresses of users. A new address has to be verified with a link
+// sent to it before it can be used to log in, the link is a token signed with the JWT keys
+type EmailService struct {
+	userSvc   *UserService
+	keys      *KeySet
+	notifier  Notifier
+	verifyURL string // EMAIL_VERIFICATION_URL, the page that takes the token, the message has the bare token without it
+}
+
+func NewEmailService(userSvc *UserService, keys *KeySet, notifier Notifier, verifyURL string) *EmailService {
+	return &EmailService{
+		userSvc:   userSvc,
+		keys:      keys,
+		notifier:  notifier,
+		verifyURL: verifyURL,
+	}
+}
+
+// normalizeEmail lower-cases an address and rejects anything but a plain address like alice@example.com
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) > MAX_EMAIL_LEN {
+		return "", ErrInvalidEmail
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// ChangeEmail sets the user's email and sends a verification link to it, "" removes the email.
+// Setting the same email again only sends a new link if it is not verified yet
+func (es *EmailService) ChangeEmail(ctx context.Context, id int, newEmail string, actorId int, actorRole string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	if newEmail != "" {
+		var err error
+		if newEmail, err = normalizeEmail(newEmail); err != nil {
+			return err
+		}
+	}
+
+	user, err := es.userSvc.GetUserById(ctx, id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+
+	if user.Email != nil && *user.Email == newEmail {
+		if user.EmailVerifiedAt != nil {
+			return nil
+		}
+		return es.sendVerification(user.Id, newEmail)
+	}
+
+	if err := es.userSvc.ChangeEmail(ctx, id, newEmail, actorId, actorRole); err != nil {
+		return err
+	}
+	if newEmail == "" {
+		return nil
+	}
+	return es.sendVerification(user.Id, newEmail)
+}
+
+// ResendVerification sends a new verification link for the user's unverified email
+func (es *EmailService) ResendVerification(ctx context.Context, id int, actorId int, actorRole string) error {
+	user, err := es.userSvc.GetUserById(ctx, id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+	if user.Email == nil {
+		return ErrNoEmail
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	return es.sendVerification(user.Id, *user.Email)
+}
+
+// VerifyEmail checks a verification token, it fails once the user has changed their email
+func (es *EmailService) VerifyEmail(ctx context.Context, token string) error {
+	claims := &Claims{}
+	parsed, err := es.keys.Parse(token, claims, TOKEN_AUDIENCE_VERIFY_EMAIL)
+	if err != nil || !parsed.Valid || claims.Email == "" {
+		return ErrInvalidVerificationToken
+	}
+	return es.userSvc.VerifyEmail(ctx, claims.UserID, claims.Email)
+}
+
+// sendVerification sends the link in the background, like password resets
+func (es *EmailService) sendVerification(userId int, email string) error {
+	token, err := es.keys.GenerateEmailVerificationJWT(userId, email, time.Now().Add(EMAIL_VERIFICATION_TTL))
+	if err != nil {
+		return err
+	}
+
+	link := token
+	if es.verifyURL != "" {
+		link = es.verifyURL + "?token=" + url.QueryEscape(token)
+	}
+	msg := Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("To use %s with your TODO List account, open this within %d hours:\n\n%s\n\n"+
+			"If you didn't ask for it, ignore this message.", email, int(EMAIL_VERIFICATION_TTL.Hours()), link),
+	}
+	go func() {
+		if err := es.notifier.Notify(context.Background(), msg); err != nil {
+			log.Println("Error sending email verification: ", err)
+		}
+	}()
+	return nil
+}
+
+// emailOrName is where messages to the user go, the verified email or else the name
+func emailOrName(user *User) string {
+	if user.Email != nil && user.EmailVerifiedAt != nil {
+		return *user.Email
+	}
+	return user.Name
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendVerification(t *testing.T) {
+	t.Setenv("JWT_KEYS_DIR", "")
+	t.Setenv("JWT_SECRET", "test secret")
+	keys, err := LoadKeySet(EMAIL_VERIFICATION_TTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := NewMemoryNotifier()
+	es := NewEmailService(nil, keys, notifier, "https://todo.example.com/verify")
+
+	if err := es.sendVerification(7, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the message is sent in the background
+	var messages []Message
+	for deadline := time.Now().Add(time.Second); len(messages) == 0 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+		messages = notifier.Messages()
+	}
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	msg := messages[0]
+	if msg.To != "alice@example.com" {
+		t.Errorf("message to %q, want alice@example.com", msg.To)
+	}
+
+	_, link, ok := strings.Cut(msg.Body, "https://todo.example.com/verify?token=")
+	if !ok {
+		t.Fatalf("message has no verification link: %q", msg.Body)
+	}
+	token, err := url.QueryUnescape(strings.Fields(link)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		audience string
+		valid    bool
+	}{
+		{TOKEN_AUDIENCE_VERIFY_EMAIL, true},
+		{TOKEN_AUDIENCE_ACCESS, false},
+		{TOKEN_AUDIENCE_2FA, false},
+	}
+	for _, tt := range tests {
+		claims := &Claims{}
+		parsed, err := keys.Parse(token, claims, tt.audience)
+		valid := err == nil && parsed.Valid
+		if valid != tt.valid {
+			t.Errorf("Parse as %q valid = %v (%v), want %v", tt.audience, valid, err, tt.valid)
+		}
+		if valid && (claims.UserID != 7 || claims.Email != "alice@example.com") {
+			t.Errorf("verification token is for user %d and %q, want 7 and alice@example.com", claims.UserID, claims.Email)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // empty when the address is rejected
+	}{
+		{"Alice@Example.COM", "alice@example.com"},
+		{"bob.smith+todo@mail.example.org", "bob.smith+todo@mail.example.org"},
+		{"Alice <alice@example.com>", ""},
+		{"alice", ""},
+		{"alice@", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeEmail(tt.input)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("normalizeEmail(%q) = %q, want an error", tt.input, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeEmail(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
@@ -34,6 +34,78 @@ async function handleError(res, defaultMessage) {
 // await handleError(res, "text")
 
 
+// the access token lives for minutes, on a 401 the refresh token is swapped for a new pair once and
+// the request is retried. Concurrent requests share one refresh, a refresh token can be used only once
+let refreshing = null
+
+export async function refreshTokens() {
+    if (!refreshing) {
+        refreshing = (async () => {
+            const refreshToken = localStorage.getItem("refresh_token")
+            if (!refreshToken) {
+                return false
+            }
+            const res = await fetch(`${base_link}/token/refresh`, {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify({ refresh_token: refreshToken })
+            })
+            if (!res.ok) {
+                localStorage.removeItem("token")
+                localStorage.removeItem("refresh_token")
+                return false
+            }
+            const { token, refresh_token } = await res.json()
+            localStorage.setItem("token", token)
+            localStorage.setItem("refresh_token", refresh_token)
+            return true
+        })().finally(() => {
+            refreshing = null
+        })
+    }
+    return await refreshing
+}
+
+async function authFetch(url, options) {
+    const res = await fetch(url, options)
+    if (res.status !== 401 || !(await refreshTokens())) {
+        return res
+    }
+    const headers = { ...options.headers, Authorization: `Bearer ${localStorage.getItem("token")}` }
+    return await fetch(url, { ...options, headers })
+}
+
+
+// list endpoints return pages { items, next_cursor }, the panel shows whole lists so follow the cursors
+async function fetchAllPages(path, defaultMessage) {
+    const token = localStorage.getItem("token")
+    let items = []
+    let cursor = null
+
+    do {
+        const params = new URLSearchParams({ limit: "200" })
+        if (cursor) {
+            params.set("cursor", cursor)
+        }
+        const res = await authFetch(`${base_link}${path}?${params}`, {
+            method: "GET",
+            headers: {
+                "Content-Type": "application/json",
+                Authorization: `Bearer ${token}`
+            },
+        })
+        if (!res.ok) {
+            await handleError(res, defaultMessage)
+        }
+        const page = await res.json()
+        items = items.concat(page.items)
+        cursor = page.next_cursor
+    } while (cursor)
+
+    return items
+}
+
+
 
 export async function signUp(name, password) {
     const res = await fetch(`${base_link}/sign-up`, {
@@ -67,25 +139,47 @@ export async function login(name, password) {
     return await res.json()
 }
 
-// ADMIN FUNCTIONS
-export async function getAllUsersAdmin(){
-    const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/users`, {
-        method: "GET",
-        headers: {
-            "Content-Type": "application/json",
-            Authorization: `Bearer ${token}`
-        },
+// completes a login that answered with mfa_required, with a TOTP code or a recovery code
+export async function loginTwoFactor(challengeToken, code) {
+    const isRecoveryCode = code.includes("-")
+    const res = await fetch(`${base_link}/login/2fa`, {
+        method: "POST",
+        headers: {"Content-Type": "application/json"},
+        body: JSON.stringify({
+            challenge_token: challengeToken,
+            code: isRecoveryCode ? "" : code,
+            recovery_code: isRecoveryCode ? code : ""
+        })
     })
     if (!res.ok) {
-        await handleError(res, "Failed to get all users")
+        await handleError(res, "Failed to verify the code")
     }
     return await res.json()
 }
 
+export async function logout(all = false) {
+    const refreshToken = localStorage.getItem("refresh_token")
+    if (!refreshToken) {
+        return
+    }
+    const res = await fetch(`${base_link}/logout`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ refresh_token: refreshToken, all: all })
+    })
+    if (!res.ok) {
+        await handleError(res, "Failed to log out")
+    }
+}
+
+// ADMIN FUNCTIONS
+export async function getAllUsersAdmin() {
+    return await fetchAllPages("/admin/users", "Failed to get all users")
+}
+
 export async function createNewUserAdmin(name, password){
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/users`, {
+    const res = await authFetch(`${base_link}/admin/users`, {
         method: "POST",
         headers: {
             "Content-Type": "application/json",
@@ -104,7 +198,7 @@ export async function createNewUserAdmin(name, password){
 
 export async function getUserByIDAdmin(userId){
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/users/${userId}`, {
+    const res = await authFetch(`${base_link}/admin/users/${userId}`, {
         method: "GET",
         headers: {
             "Content-Type": "application/json",
@@ -118,25 +212,14 @@ export async function getUserByIDAdmin(userId){
 }
 
 
-export async function getUserTasksAdmin(userId){
-    const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/users/${userId}/tasks`, {
-        method: "GET",
-        headers: {
-            "Content-Type": "application/json",
-            Authorization: `Bearer ${token}`
-        },
-    })
-    if (!res.ok) {
-       await handleError(res, "Failed to get user's tasks")
-    }
-    return await res.json()
+export async function getUserTasksAdmin(userId) {
+    return await fetchAllPages(`/admin/users/${userId}/tasks`, "Failed to get user's tasks")
 }
 
 
 export async function createNewTaskAdmin(userId, title, description){
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/users/${userId}/tasks`, {
+    const res = await authFetch(`${base_link}/admin/users/${userId}/tasks`, {
         method: "POST",
         headers: {
             "Content-Type": "application/json",
@@ -153,7 +236,7 @@ export async function createNewTaskAdmin(userId, title, description){
 
 export async function renameUserAdmin(userId, newName){
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/users/${userId}/rename`, {
+    const res = await authFetch(`${base_link}/admin/users/${userId}/rename`, {
         method: "PATCH",
         headers: {
             "Content-Type": "application/json",
@@ -169,7 +252,7 @@ export async function renameUserAdmin(userId, newName){
 
 export async function changeUserPasswordAdmin(userId, oldPassword, newPassword){
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/users/${userId}/password`, {
+    const res = await authFetch(`${base_link}/admin/users/${userId}/password`, {
         method: "PATCH",
         headers: {
             "Content-Type": "application/json",
@@ -184,15 +267,25 @@ export async function changeUserPasswordAdmin(userId, oldPassword, newPassword){
 }
 
 
-export async function updateUserRoleAdmin(userId){
+// confirmed is needed to change your own role, without it the server answers 428
+export async function updateUserRoleAdmin(userId, role, confirmed = false){
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/users/${userId}/role`, {
+    const res = await authFetch(`${base_link}/admin/users/${userId}/role`, {
         method: "PATCH",
         headers: {
             "Content-Type": "application/json",
             Authorization: `Bearer ${token}`
         },
+        body: JSON.stringify({
+            role: role,
+            confirm: confirmed
+        })
     })
+    if (res.status === 428) {
+        const err = new Error(await res.text())
+        err.confirmRequired = true
+        throw err
+    }
     if (!res.ok) {
         await handleError(res, "Failed to update user's role")
     }
@@ -200,39 +293,43 @@ export async function updateUserRoleAdmin(userId){
 }
 
 
-export async function deleteUserAdmin(userId){
+export async function getRolesAdmin(){
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/users/${userId}`, {
-        method: "DELETE",
+    const res = await authFetch(`${base_link}/admin/roles`, {
+        method: "GET",
         headers: {
-            "Content-Type": "application/json",
             Authorization: `Bearer ${token}`
         },
     })
     if (!res.ok) {
-        await handleError(res, "Failed to delete user")
+        await handleError(res, "Failed to get roles")
     }
     return await res.json()
 }
 
-export async function getAllTasksAdmin(){
+
+export async function deleteUserAdmin(userId){
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/tasks`, {
-        method: "GET",
+    const res = await authFetch(`${base_link}/admin/users/${userId}`, {
+        method: "DELETE",
         headers: {
             "Content-Type": "application/json",
             Authorization: `Bearer ${token}`
         },
     })
     if (!res.ok) {
-        await handleError(res, "Failed to get all tasks")
+        await handleError(res, "Failed to delete user")
     }
     return await res.json()
 }
 
+export async function getAllTasksAdmin() {
+    return await fetchAllPages("/admin/tasks", "Failed to get all tasks")
+}
+
 export async function deleteTaskAdmin(taskId){
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/tasks/${taskId}`, {
+    const res = await authFetch(`${base_link}/admin/tasks/${taskId}`, {
         method: "DELETE",
         headers: {
             "Content-Type": "application/json",
@@ -248,7 +345,7 @@ export async function deleteTaskAdmin(taskId){
 
 export async function switchTaskStatusAdmin(taskId){
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/tasks/${taskId}/switch`, {
+    const res = await authFetch(`${base_link}/admin/tasks/${taskId}/switch`, {
         method: "PATCH",
         headers: {
             "Content-Type": "application/json",
@@ -263,7 +360,7 @@ export async function switchTaskStatusAdmin(taskId){
 
 export async function changeTaskTitleAdmin(taskId, newTitle){
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/tasks/${taskId}/title`, {
+    const res = await authFetch(`${base_link}/admin/tasks/${taskId}/title`, {
         method: "PATCH",
         headers: {
             "Content-Type": "application/json",
@@ -279,7 +376,7 @@ export async function changeTaskTitleAdmin(taskId, newTitle){
 
 export async function changeTaskDescriptionAdmin(taskId, newDescription){
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/admin/tasks/${taskId}/description`, {
+    const res = await authFetch(`${base_link}/admin/tasks/${taskId}/description`, {
         method: "PATCH",
         headers: {
             "Content-Type": "application/json",
@@ -300,7 +397,7 @@ export async function changeTaskDescriptionAdmin(taskId, newDescription){
 
 export async function getMe() {
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/me`, {
+    const res = await authFetch(`${base_link}/me`, {
         method: "GET",
         headers: {
             "Content-Type": "application/json",
@@ -316,7 +413,7 @@ export async function getMe() {
 
 export async function renameMe(newName) {
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/me/rename`, {
+    const res = await authFetch(`${base_link}/me/rename`, {
         method: "PATCH",
         headers: {
             "Content-Type": "application/json",
@@ -332,7 +429,7 @@ export async function renameMe(newName) {
 
 export async function changeMyPassword(oldPassword, newPassword) {
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/me/password`, {
+    const res = await authFetch(`${base_link}/me/password`, {
         method: "PATCH",
         headers: {
             "Content-Type": "application/json",
@@ -348,7 +445,7 @@ export async function changeMyPassword(oldPassword, newPassword) {
 
 export async function deleteMe() {
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/me`, {
+    const res = await authFetch(`${base_link}/me`, {
         method: "DELETE",
         headers: {
             "Content-Type": "application/json",
@@ -362,24 +459,13 @@ export async function deleteMe() {
 }
 
 export async function getMyTasks() {
-    const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/me/tasks`, {
-        method: "GET",
-        headers: {
-            "Content-Type": "application/json",
-            Authorization: `Bearer ${token}`
-        },
-    })
-    if (!res.ok) {
-        await handleError(res, "Failed to load your tasks")
-    }
-    return await res.json()
+    return await fetchAllPages("/me/tasks", "Failed to load your tasks")
 }
 
 
 export async function createNewTask(title, description) {
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/me/tasks`, {
+    const res = await authFetch(`${base_link}/me/tasks`, {
         method: "POST",
         headers: {
             "Content-Type": "application/json",
@@ -396,7 +482,7 @@ export async function createNewTask(title, description) {
 
 export async function deleteTask(taskId) {
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/me/tasks/${taskId}`, {
+    const res = await authFetch(`${base_link}/me/tasks/${taskId}`, {
         method: "DELETE",
         headers: {
             "Content-Type": "application/json",
@@ -411,7 +497,7 @@ export async function deleteTask(taskId) {
 
 export async function switchTaskStatus(taskId) {
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/me/tasks/${taskId}/switch`, {
+    const res = await authFetch(`${base_link}/me/tasks/${taskId}/switch`, {
         method: "PATCH",
         headers: {
             "Content-Type": "application/json",
@@ -426,7 +512,7 @@ export async function switchTaskStatus(taskId) {
 
 export async function changeTaskTitle(taskId, newTitle) {
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/me/tasks/${taskId}/title`, {
+    const res = await authFetch(`${base_link}/me/tasks/${taskId}/title`, {
         method: "PATCH",
         headers: {
             "Content-Type": "application/json",
@@ -443,7 +529,7 @@ export async function changeTaskTitle(taskId, newTitle) {
 
 export async function changeTaskDescription(taskId, newDescription) {
     const token = localStorage.getItem("token")
-    const res = await fetch(`${base_link}/me/tasks/${taskId}/description`, {
+    const res = await authFetch(`${base_link}/me/tasks/${taskId}/description`, {
         method: "PATCH",
         headers: {
             "Content-Type": "application/json",
@@ -4,28 +4,33 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/jackc/pgx/v5/pgconn"
-	"golang.org/x/crypto/bcrypt"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
-func Encrypter(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+func IsForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23503"
 	}
-	return string(hash), nil
+	return false
 }
 
-func CompareHashAndPassword(hashedPassword string, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	return false
 }
 
-func IsForeignKeyViolation(err error) bool {
+// IsDataException reports postgres errors of class 22, e.g. a value that can't be cast to its type
+func IsDataException(err error) bool {
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
-		return pgErr.Code == "23503"
+		return len(pgErr.Code) == 5 && pgErr.Code[:2] == "22"
 	}
 	return false
 }
@@ -37,6 +42,29 @@ func EncodeJSONhelper(w http.ResponseWriter, data any) error {
 	return nil
 }
 
+// clientIP is the address of the client, taken from X-Forwarded-For or X-Real-IP only behind a
+// trusted reverse proxy, otherwise anyone could pick their own IP. Only the rightmost X-Forwarded-For
+// entry is used, it is the one the proxy appended, the entries before it come from the client
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			forwarded := values[len(values)-1]
+			last := strings.TrimSpace(forwarded[strings.LastIndex(forwarded, ",")+1:])
+			if last != "" {
+				return last
+			}
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return strings.TrimSpace(realIP)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func ConvertToInt(s string) (int, error) {
 	return strconv.Atoi(s)
 }
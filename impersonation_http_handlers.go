@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// staff with users.impersonate can act as a user through /me to see what the user sees. The token is
+// short-lived, can't reach /admin or the credential routes, and every change made with it is recorded
+// in the audit log under the impersonator
+
+// ImpersonateUserHTTP mints an impersonation token for the user, the minting itself is recorded first
+func (s *Server) ImpersonateUserHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetId, ok := ctx.Value(targetIdContextKey).(int)
+	if !ok {
+		log.Println("Error getting target user id from context")
+		http.Error(w, "Unauthorized", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := s.userSvc.GetUserById(ctx, targetId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting user by id: ", err)
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrIdMustBeGtZero):
+			status = http.StatusBadRequest
+		case errors.Is(err, ErrUserNotFound):
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if user.Id == claims.UserID {
+		http.Error(w, ErrImpersonateSelf.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// like the users predicates, a role can only act as users whose role has no permission it lacks
+	manages, err := s.roleSvc.CanManage(ctx, claims.Role, user.Role)
+	if err != nil {
+		log.Println("Error getting role permissions: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !manages {
+		http.Error(w, ErrRoleTooPowerful.Error(), http.StatusForbidden)
+		return
+	}
+
+	token, expiresAt, err := s.authSvc.Impersonate(user, claims)
+	if err != nil {
+		log.Println("Error generating impersonation token: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entry := s.newAuditEntry(r, claims)
+	entry.Action = AUDIT_ACTION_USER_IMPERSONATE
+	entry.TargetType = AUDIT_TARGET_USER
+	entry.TargetId = strconv.Itoa(user.Id)
+	entry.NewValue = map[string]any{"expires_at": expiresAt}
+	if err := s.auditSvc.Record(ctx, entry); err != nil {
+		log.Println("Error recording audit entry: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusCreated)
+	response := map[string]any{
+		"token":      token,
+		"expires_at": expiresAt,
+		"user":       newUserResponse(user),
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// AuditImpersonation records every change made with an impersonation token that succeeded, as done
+// by the impersonator to the impersonated user. Other requests pass through. As in Audit the response
+// waits for the entry, a change that can't be recorded fails with 500
+func (s *Server) AuditImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userContextKey).(*Claims)
+		if !ok || claims.Impersonator == nil || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		response := newBufferedResponse()
+		next.ServeHTTP(response, r)
+		status := response.Status()
+		if status >= http.StatusBadRequest {
+			response.flush(w)
+			return
+		}
+
+		entry := s.newAuditEntry(r, claims)
+		entry.Action = AUDIT_ACTION_USER_IMPERSONATED_WRITE
+		entry.TargetType = AUDIT_TARGET_USER
+		entry.TargetId = strconv.Itoa(claims.UserID)
+		entry.NewValue = map[string]any{"method": r.Method, "path": r.URL.Path, "status": status}
+		if err := s.auditSvc.Record(context.WithoutCancel(r.Context()), entry); err != nil {
+			log.Println("Error recording audit entry: ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response.flush(w)
+	})
+}
@@ -2,28 +2,147 @@ package main
 
 import (
 	"context"
+	"time"
 )
 
 // TODO : UPDATE FUNCTION FOR ALL REPOSITORIES
 
 type UserRepository interface {
-	GetAll(ctx context.Context) ([]User, error)
+	GetAll(ctx context.Context, filter UserFilter) (Page[User], error)
 	GetById(ctx context.Context, id int, actorId int, actorRole string) (*User, error)
 	Create(ctx context.Context, user User) (int, error)
 	Delete(ctx context.Context, id int, actorId int, actorRole string) error
 	UpdatePassword(ctx context.Context, id int, newHash string, actorId int, actorRole string) error
+	RehashPassword(ctx context.Context, id int, oldHash string, newHash string) error
 	UpdateName(ctx context.Context, id int, newName string, actorId int, actorRole string) error
-	UpdateRole(ctx context.Context, id int, newRole string) error
+	UpdateRole(ctx context.Context, id int, newRole string, audit AuditEntry) (bool, error)
 	Authenticate(ctx context.Context, name string) (*User, error)
+	GetTokenVersion(ctx context.Context, id int) (int, error)
+	UpdateEmail(ctx context.Context, id int, newEmail *string, actorId int, actorRole string) error
+	VerifyEmail(ctx context.Context, id int, email string) error
 }
 
 type TaskRepository interface {
-	GetAll(ctx context.Context) ([]Task, error)
-	GetByUserId(ctx context.Context, id int, actorId int, actorRole string) ([]Task, error)
-	Create(ctx context.Context, task Task) (int, error)
+	GetAll(ctx context.Context, filter TaskFilter) (Page[Task], error)
+	GetByUserId(ctx context.Context, id int, filter TaskFilter, actorId int, actorRole string) (Page[Task], error)
+	Search(ctx context.Context, q string, userId int, params PageParams, actorId int, actorRole string) (Page[TaskSearchResult], error)
+	Create(ctx context.Context, task Task, actorId int, actorRole string) (int, error)
+	CreateNextOccurrence(ctx context.Context, parent Task, dueDate time.Time, recurrence string, actorId int, actorRole string) (int, error)
 	Delete(ctx context.Context, id int, actorId int, actorRole string) error
+	Restore(ctx context.Context, id int, actorId int, actorRole string) error
+	DeleteForever(ctx context.Context, id int, actorId int, actorRole string) error
+	PurgeTrash(ctx context.Context, deletedBefore time.Time) (int64, error)
+	GetHistory(ctx context.Context, taskId int, actorId int, actorRole string) ([]TaskEvent, error)
 	UpdateTitle(ctx context.Context, newTitle string, id int, actorId int, actorRole string) error
 	UpdateDescription(ctx context.Context, newDescription string, id int, actorId int, actorRole string) error
+	UpdateDueDate(ctx context.Context, newDueDate *time.Time, recurrence *string, id int, actorId int, actorRole string) error
+	UpdatePriority(ctx context.Context, newPriority string, id int, actorId int, actorRole string) error
+	UpdateRecurrence(ctx context.Context, newRecurrence *string, id int, actorId int, actorRole string) error
 	SwitchTaskStatus(ctx context.Context, id int, actorId int, actorRole string) error
 	GetTaskById(ctx context.Context, taskId int, actorId int, actorRole string) (*Task, error)
 }
+
+type LabelRepository interface {
+	GetByUserId(ctx context.Context, userId int, actorId int, actorRole string) ([]Label, error)
+	GetById(ctx context.Context, id int, actorId int, actorRole string) (*Label, error)
+	Create(ctx context.Context, label Label) (int, error)
+	Delete(ctx context.Context, id int, actorId int, actorRole string) error
+	UpdateName(ctx context.Context, newName string, id int, actorId int, actorRole string) error
+	UpdateColor(ctx context.Context, newColor string, id int, actorId int, actorRole string) error
+	AttachToTask(ctx context.Context, taskId int, labelId int, actorId int, actorRole string) error
+	DetachFromTask(ctx context.Context, taskId int, labelId int, actorId int, actorRole string) error
+}
+
+type TaskItemRepository interface {
+	GetByTaskId(ctx context.Context, taskId int, actorId int, actorRole string) ([]TaskItem, error)
+	GetById(ctx context.Context, taskId int, itemId int, actorId int, actorRole string) (*TaskItem, error)
+	Create(ctx context.Context, taskId int, title string, actorId int, actorRole string) (int, error)
+	Delete(ctx context.Context, taskId int, itemId int, actorId int, actorRole string) error
+	UpdateTitle(ctx context.Context, newTitle string, taskId int, itemId int, actorId int, actorRole string) error
+	SwitchStatus(ctx context.Context, taskId int, itemId int, actorId int, actorRole string) error
+	Move(ctx context.Context, newPosition int, taskId int, itemId int, actorId int, actorRole string) error
+}
+
+type ProjectRepository interface {
+	GetByUserId(ctx context.Context, userId int, withArchived bool, actorId int, actorRole string) ([]Project, error)
+	GetById(ctx context.Context, id int, actorId int, actorRole string) (*Project, error)
+	Create(ctx context.Context, project Project) (int, error)
+	Delete(ctx context.Context, id int, reassignTo *int, actorId int, actorRole string) error
+	UpdateName(ctx context.Context, newName string, id int, actorId int, actorRole string) error
+	UpdateColor(ctx context.Context, newColor string, id int, actorId int, actorRole string) error
+	SwitchArchived(ctx context.Context, id int, actorId int, actorRole string) error
+}
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token RefreshToken) error
+	Rotate(ctx context.Context, oldHash string, next RefreshToken) (*RefreshToken, error)
+	RevokeFamily(ctx context.Context, tokenHash string) (int, error)
+	RevokeAllForUser(ctx context.Context, userId int) error
+}
+
+type PersonalAccessTokenRepository interface {
+	GetByUserId(ctx context.Context, userId int, actorId int, actorRole string) ([]PersonalAccessToken, error)
+	GetById(ctx context.Context, id int, actorId int, actorRole string) (*PersonalAccessToken, error)
+	Create(ctx context.Context, token PersonalAccessToken) (int, error)
+	Delete(ctx context.Context, id int, actorId int, actorRole string) error
+	Authenticate(ctx context.Context, tokenHash string) (*PersonalAccessToken, string, error)
+}
+
+type TwoFactorRepository interface {
+	Get(ctx context.Context, userId int) (*TwoFactor, error)
+	Enroll(ctx context.Context, userId int, secret string) error
+	Confirm(ctx context.Context, userId int, step int64, codeHashes []string) error
+	UseStep(ctx context.Context, userId int, step int64) error
+	RecordFailure(ctx context.Context, userId int, maxAttempts int, lockedUntil time.Time) error
+	ReplaceRecoveryCodes(ctx context.Context, userId int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userId int, codeHash string) error
+	CountRecoveryCodes(ctx context.Context, userId int) (int, error)
+	Disable(ctx context.Context, userId int) error
+}
+
+type SettingsRepository interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string) error
+}
+
+type LoginThrottleRepository interface {
+	GetLocked(ctx context.Context, keys map[string]string, now time.Time) (*time.Time, error)
+	RecordFailure(ctx context.Context, kind string, key string, now time.Time, window time.Duration) (int, error)
+	Lock(ctx context.Context, kind string, key string, until time.Time) error
+	Clear(ctx context.Context, kind string, key string) error
+	GetAll(ctx context.Context, since time.Time) ([]LoginThrottle, error)
+}
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, token PasswordResetToken, notBefore time.Time) error
+	GetUserId(ctx context.Context, tokenHash string, now time.Time) (int, error)
+	Use(ctx context.Context, tokenHash string, now time.Time) (int, error)
+}
+
+type RoleRepository interface {
+	GetAll(ctx context.Context) ([]Role, error)
+	GetByName(ctx context.Context, name string) (*Role, error)
+	GetPermissions(ctx context.Context, name string) ([]string, error)
+	GetAllPermissions(ctx context.Context) ([]Permission, error)
+	Create(ctx context.Context, role Role) error
+	Update(ctx context.Context, name string, description *string, permissions []string) error
+	Delete(ctx context.Context, name string) error
+}
+
+type AdminAuditRepository interface {
+	Record(ctx context.Context, entry AuditEntry) error
+	GetAll(ctx context.Context, filter AuditFilter) (Page[AuditEntry], error)
+	Export(ctx context.Context, filter AuditFilter, fn func(AuditEntry) error) error
+}
+
+// PasswordHasher hashes passwords into strings that carry their algorithm and parameters
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded string, password string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
+
+// Notifier delivers messages to users, see NewNotifierFromEnv for the backends
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"github.com/go-chi/chi/v5"
+	"log"
 	"net/http"
-	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,9 +15,31 @@ import (
 )
 
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Role   string `json:"role"`
+	UserID       int    `json:"user_id"`
+	Role         string `json:"role"`
+	TokenVersion int    `json:"token_version"`   // must match users.token_version, see JWTmiddleware
+	MFA          bool   `json:"mfa"`             // the login passed the second factor
+	Email        string `json:"email,omitempty"` // the address an email verification token is for
+	// set on impersonation tokens, the staff member acting as UserID
+	Impersonator *Impersonator `json:"impersonator,omitempty"`
 	jwt.RegisteredClaims
+
+	// set when the request was made with a personal access token instead of a JWT
+	TokenId int      `json:"-"`
+	Scopes  []string `json:"-"`
+}
+
+// Impersonator is who holds an impersonation token. The token stops working when the impersonator's
+// token version changes or their role loses PERM_USERS_IMPERSONATE
+type Impersonator struct {
+	UserID       int    `json:"user_id"`
+	Role         string `json:"role"`
+	TokenVersion int    `json:"token_version"`
+}
+
+// HasScope tells whether the request may use scope, JWTs carry every scope
+func (c *Claims) HasScope(scope string) bool {
+	return c.TokenId == 0 || slices.Contains(c.Scopes, scope)
 }
 
 type contextKey string
@@ -25,7 +50,11 @@ type contextKeyTargetId string
 
 const targetIdContextKey = contextKeyTargetId("target_id")
 
-func JWTmiddleware(next http.Handler) http.Handler {
+// JWTmiddleware verifies the access token and rejects tokens issued before the user's last password
+// or role change, the user's token version is bumped on those and cached for TOKEN_VERSION_CACHE_TTL.
+// Bearer tokens starting with PAT_PREFIX are personal access tokens, their routes check scopes with RequireScope.
+// Responses to impersonation tokens carry IMPERSONATION_HEADER
+func (s *Server) JWTmiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -40,53 +69,261 @@ func JWTmiddleware(next http.Handler) http.Handler {
 		}
 
 		tokenStr := bearerToken[1]
-		claims := &Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			secret := os.Getenv("JWT_SECRET")
-			if secret == "" {
-				return nil, ErrTokenNotSet
+		if strings.HasPrefix(tokenStr, PAT_PREFIX) {
+			claims, err := s.patSvc.Authenticate(r.Context(), tokenStr)
+			if errors.Is(err, ErrInvalidPersonalAccessToken) {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
 			}
-			return []byte(secret), nil
-		})
+			if err != nil {
+				log.Println("Error authenticating personal access token: ", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			ctx := context.WithValue(r.Context(), userContextKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 
+		claims := &Claims{}
+
+		token, err := s.keys.Parse(tokenStr, claims, TOKEN_AUDIENCE_ACCESS)
 		if err != nil || !token.Valid {
 			http.Error(w, "Invalid Token", http.StatusUnauthorized)
 			return
 		}
 
+		version, err := s.userSvc.TokenVersion(r.Context(), claims.UserID)
+		if err != nil && !errors.Is(err, ErrUserNotFound) {
+			log.Println("Error getting token version: ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err != nil || version != claims.TokenVersion {
+			http.Error(w, "Token Revoked", http.StatusUnauthorized)
+			return
+		}
+
+		if claims.Impersonator != nil {
+			valid, err := s.impersonatorValid(r.Context(), claims.Impersonator)
+			if err != nil {
+				log.Println("Error checking impersonator: ", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !valid {
+				http.Error(w, "Token Revoked", http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set(IMPERSONATION_HEADER, strconv.Itoa(claims.Impersonator.UserID))
+		}
+
 		ctx := context.WithValue(r.Context(), userContextKey, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func AdminOnly(next http.Handler) http.Handler {
+// impersonatorValid tells whether the impersonator still has the session and the permission the token was minted with
+func (s *Server) impersonatorValid(ctx context.Context, impersonator *Impersonator) (bool, error) {
+	version, err := s.userSvc.TokenVersion(ctx, impersonator.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if version != impersonator.TokenVersion {
+		return false, nil
+	}
+	return s.roleSvc.HasPermission(ctx, impersonator.Role, PERM_USERS_IMPERSONATE)
+}
+
+// StaffOnly lets roles with any permission through, only with a second factor while require_admin_2fa
+// is on. What they can do under /admin is up to RequirePermission on each route. Impersonation tokens
+// never get in, whatever the role of the impersonated user
+func (s *Server) StaffOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		claims, ok := r.Context().Value(userContextKey).(*Claims)
-		if !ok || claims.Role != ADMIN {
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if claims.Impersonator != nil {
+			http.Error(w, ErrImpersonating.Error(), http.StatusForbidden)
+			return
+		}
+		staff, err := s.roleSvc.IsStaff(r.Context(), claims.Role)
+		if err != nil {
+			log.Println("Error getting role permissions: ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !staff {
 			http.Error(w, "This is for admins only!", http.StatusForbidden)
 			return
 		}
+
+		required, err := s.settingsSvc.RequireAdminTwoFactor(r.Context())
+		if err != nil {
+			log.Println("Error getting settings: ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if required && !claims.MFA {
+			http.Error(w, ErrTwoFactorRequired.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission lets the request through when the caller's role has permission
+func (s *Server) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(userContextKey).(*Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			allowed, err := s.roleSvc.HasPermission(r.Context(), claims.Role, permission)
+			if err != nil {
+				log.Println("Error getting role permissions: ", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				http.Error(w, ErrPermissionDenied.Error()+": "+permission, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireReadWritePermission asks for read on GET requests and for write on the rest, like RequireScope
+func (s *Server) RequireReadWritePermission(read string, write string) func(http.Handler) http.Handler {
+	readMw, writeMw := s.RequirePermission(read), s.RequirePermission(write)
+	return func(next http.Handler) http.Handler {
+		readNext, writeNext := readMw(next), writeMw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				readNext.ServeHTTP(w, r)
+				return
+			}
+			writeNext.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope lets personal access tokens through only with resource:read for GET requests and
+// resource:write for the rest, JWTs always pass
+func RequireScope(resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(userContextKey).(*Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			scope := resource + ":" + SCOPE_WRITE
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				scope = resource + ":" + SCOPE_READ
+			}
+			if !claims.HasScope(scope) {
+				http.Error(w, ErrInsufficientScope.Error()+": "+scope, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SessionOnly keeps personal access tokens and impersonation tokens away from routes that manage credentials
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(userContextKey).(*Claims)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if claims.TokenId != 0 {
+			http.Error(w, ErrSessionRequired.Error(), http.StatusForbidden)
+			return
+		}
+		if claims.Impersonator != nil {
+			http.Error(w, ErrImpersonating.Error(), http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
 // for creating jwt key
 
-func GenerateJWT(userID int, role string) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
+func (ks *KeySet) GenerateJWT(userID int, role string, tokenVersion int, mfa bool, expiresAt time.Time) (string, error) {
+	claims := Claims{
+		UserID:       userID,
+		Role:         role,
+		TokenVersion: tokenVersion,
+		MFA:          mfa,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{TOKEN_AUDIENCE_ACCESS},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return ks.Sign(claims)
+}
+
+// GenerateImpersonationJWT lets impersonator act as user, with the user's role. It has no refresh token
+func (ks *KeySet) GenerateImpersonationJWT(user *User, impersonator Impersonator, expiresAt time.Time) (string, error) {
+	claims := Claims{
+		UserID:       user.Id,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		Impersonator: &impersonator,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{TOKEN_AUDIENCE_ACCESS},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return ks.Sign(claims)
+}
+
+// GenerateChallengeJWT is handed out by /login when the user has 2FA, /login/2fa swaps it for tokens.
+// Its audience keeps JWTmiddleware from taking it for an access token
+func (ks *KeySet) GenerateChallengeJWT(userID int, tokenVersion int, expiresAt time.Time) (string, error) {
+	claims := Claims{
+		UserID:       userID,
+		TokenVersion: tokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{TOKEN_AUDIENCE_2FA},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return ks.Sign(claims)
+}
 
+// GenerateEmailVerificationJWT signs the link that verifies email for the user, it stops working once
+// the user changes their email. Its audience keeps JWTmiddleware from taking it for an access token
+func (ks *KeySet) GenerateEmailVerificationJWT(userID int, email string, expiresAt time.Time) (string, error) {
 	claims := Claims{
 		UserID: userID,
-		Role:   role,
+		Email:  email,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			Audience:  jwt.ClaimStrings{TOKEN_AUDIENCE_VERIFY_EMAIL},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return ks.Sign(claims)
 }
 
 // for injecting the keys, with context
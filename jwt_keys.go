@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// access tokens are signed with the active key of a KeySet and carry its id in the kid header.
+// Keys live as PEM files named <kid>.pem in JWT_KEYS_DIR, Ed25519 keys sign with EdDSA and RSA keys
+// with RS256. To rotate, drop the new key in the dir, make it JWT_ACTIVE_KID and list the old one in
+// JWT_RETIRED_KEYS with the time it stopped signing: it keeps verifying the tokens it signed until
+// they have expired, after that its file can be removed. Retired keys may be public keys only.
+// Without JWT_KEYS_DIR tokens are signed with JWT_SECRET (HS256) like before
+
+// signingKey is one key of a KeySet, private is nil for retired keys whose private half is gone
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	private   any
+	public    crypto.PublicKey
+	retiredAt *time.Time // nil for the active key
+}
+
+type KeySet struct {
+	active  *signingKey
+	keys    map[string]*signingKey
+	overlap time.Duration // how long a retired key keeps verifying after it was retired
+}
+
+// LoadKeySet reads JWT_KEYS_DIR, JWT_ACTIVE_KID and JWT_RETIRED_KEYS, or JWT_SECRET when there is no
+// keys dir. overlap must be the lifetime of the longest-lived token the set signs (access, challenge,
+// impersonation or email verification token), a token of a retired key is rejected after it
+func LoadKeySet(overlap time.Duration) (*KeySet, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return nil, ErrTokenNotSet
+		}
+		key := &signingKey{method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+		return &KeySet{active: key, keys: map[string]*signingKey{"": key}, overlap: overlap}, nil
+	}
+
+	retired, err := retiredKeysFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{keys: make(map[string]*signingKey), overlap: overlap}
+	activeKid := os.Getenv("JWT_ACTIVE_KID")
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := readSigningKey(path)
+		if err != nil {
+			log.Printf("Error reading JWT key %s: %v\n", path, err)
+			return nil, ErrInvalidJWTKey
+		}
+		key.kid = kid
+
+		if kid == activeKid {
+			if key.private == nil {
+				log.Printf("Active JWT key %s has no private key\n", kid)
+				return nil, ErrInvalidJWTKey
+			}
+			ks.active = key
+		} else if retiredAt, ok := retired[kid]; ok {
+			key.retiredAt = &retiredAt
+		} else {
+			log.Printf("JWT key %s is neither JWT_ACTIVE_KID nor in JWT_RETIRED_KEYS\n", kid)
+			return nil, ErrInvalidJWTKeyConfig
+		}
+		ks.keys[kid] = key
+	}
+
+	if ks.active == nil {
+		return nil, ErrInvalidJWTKeyConfig
+	}
+	return ks, nil
+}
+
+// retiredKeysFromEnv parses JWT_RETIRED_KEYS, a comma separated list of kid=RFC 3339 time
+func retiredKeysFromEnv() (map[string]time.Time, error) {
+	retired := make(map[string]time.Time)
+	value := os.Getenv("JWT_RETIRED_KEYS")
+	if value == "" {
+		return retired, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		kid, at, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || kid == "" {
+			return nil, ErrInvalidJWTKeyConfig
+		}
+		retiredAt, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, ErrInvalidJWTKeyConfig
+		}
+		retired[kid] = retiredAt
+	}
+	return retired, nil
+}
+
+// readSigningKey reads a PKCS#8, PKCS#1 or PKIX PEM file holding an Ed25519 or RSA key
+func readSigningKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidJWTKey
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, ErrInvalidJWTKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		return &signingKey{method: jwt.SigningMethodEdDSA, private: k, public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &signingKey{method: jwt.SigningMethodEdDSA, public: k}, nil
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, ErrInvalidJWTKey
+		}
+		return &signingKey{method: jwt.SigningMethodRS256, private: k, public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, ErrInvalidJWTKey
+		}
+		return &signingKey{method: jwt.SigningMethodRS256, public: k}, nil
+	}
+	return nil, ErrInvalidJWTKey
+}
+
+// Sign signs the claims with the active key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	if ks.active.kid != "" {
+		token.Header["kid"] = ks.active.kid
+	}
+	return token.SignedString(ks.active.private)
+}
+
+// Parse verifies a token against the key named by its kid header and requires its aud to be audience,
+// so a challenge or verification token is never taken for an access token. Tokens of a retired key are
+// accepted only if they were issued before it was retired and the overlap window is not over
+func (ks *KeySet) Parse(tokenStr string, claims jwt.Claims, audience string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, ErrUnknownJWTKey
+		}
+		// the alg header must be the key's own, an RSA public key must never verify an HS256 token
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, ErrUnknownJWTKey
+		}
+
+		if key.retiredAt != nil {
+			if time.Now().After(key.retiredAt.Add(ks.overlap)) {
+				return nil, ErrUnknownJWTKey
+			}
+			issuedAt, err := token.Claims.GetIssuedAt()
+			if err != nil || issuedAt == nil || issuedAt.After(*key.retiredAt) {
+				return nil, ErrUnknownJWTKey
+			}
+		}
+		return key.public, nil
+	}, jwt.WithExpirationRequired(), jwt.WithAudience(audience))
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS returns the public keys that currently verify tokens, HS256 secrets are never published
+func (ks *KeySet) JWKS() []JWK {
+	jwks := []JWK{}
+	for _, key := range ks.keys {
+		if key.retiredAt != nil && time.Now().After(key.retiredAt.Add(ks.overlap)) {
+			continue
+		}
+		switch pub := key.public.(type) {
+		case ed25519.PublicKey:
+			jwks = append(jwks, JWK{Kty: "OKP", Kid: key.kid, Use: "sig", Alg: key.method.Alg(), Crv: "Ed25519",
+				X: base64.RawURLEncoding.EncodeToString(pub)})
+		case *rsa.PublicKey:
+			jwks = append(jwks, JWK{Kty: "RSA", Kid: key.kid, Use: "sig", Alg: key.method.Alg(),
+				N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())})
+		}
+	}
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
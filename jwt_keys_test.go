@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeEd25519Key writes a PKCS#8 key named kid.pem into dir, or only its public half
+func writeEd25519Key(t *testing.T, dir string, kid string, publicOnly bool) ed25519.PrivateKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := &pem.Block{Type: "PRIVATE KEY"}
+	if publicOnly {
+		block.Type = "PUBLIC KEY"
+		block.Bytes, err = x509.MarshalPKIXPublicKey(pub)
+	} else {
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(priv)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func TestKeySetParse(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "new", false)
+	old := writeEd25519Key(t, dir, "old", false)
+	expired := writeEd25519Key(t, dir, "expired", false)
+
+	now := time.Now()
+	t.Setenv("JWT_KEYS_DIR", dir)
+	t.Setenv("JWT_ACTIVE_KID", "new")
+	t.Setenv("JWT_RETIRED_KEYS", "old="+now.Add(-time.Minute).Format(time.RFC3339)+",expired="+now.Add(-2*time.Hour).Format(time.RFC3339))
+
+	ks, err := LoadKeySet(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, key any, issuedAt time.Time, audience string) string {
+		claims := Claims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		}}
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	access, err := ks.GenerateJWT(1, USER, 0, false, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := ks.GenerateChallengeJWT(1, 0, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPublic, _ := x509.MarshalPKIXPublicKey(old.Public())
+
+	tests := []struct {
+		name     string
+		token    string
+		audience string
+		valid    bool
+	}{
+		{"active key", access, TOKEN_AUDIENCE_ACCESS, true},
+		{"challenge as challenge", challenge, TOKEN_AUDIENCE_2FA, true},
+		{"challenge as access token", challenge, TOKEN_AUDIENCE_ACCESS, false},
+		{"access token as challenge", access, TOKEN_AUDIENCE_2FA, false},
+		{"retired key, issued before retiring", sign(jwt.SigningMethodEdDSA, "old", old, now.Add(-2*time.Minute), TOKEN_AUDIENCE_ACCESS), TOKEN_AUDIENCE_ACCESS, true},
+		{"retired key, issued after retiring", sign(jwt.SigningMethodEdDSA, "old", old, now, TOKEN_AUDIENCE_ACCESS), TOKEN_AUDIENCE_ACCESS, false},
+		{"retired key past the overlap", sign(jwt.SigningMethodEdDSA, "expired", expired, now.Add(-3*time.Hour), TOKEN_AUDIENCE_ACCESS), TOKEN_AUDIENCE_ACCESS, false},
+		{"unknown kid", sign(jwt.SigningMethodEdDSA, "other", old, now, TOKEN_AUDIENCE_ACCESS), TOKEN_AUDIENCE_ACCESS, false},
+		{"no kid", sign(jwt.SigningMethodEdDSA, "", old, now, TOKEN_AUDIENCE_ACCESS), TOKEN_AUDIENCE_ACCESS, false},
+		// the public key is no secret, it must not verify an HMAC token signed with it
+		{"alg mismatch", sign(jwt.SigningMethodHS256, "old", oldPublic, now.Add(-2*time.Minute), TOKEN_AUDIENCE_ACCESS), TOKEN_AUDIENCE_ACCESS, false},
+	}
+
+	for _, tt := range tests {
+		token, err := ks.Parse(tt.token, &Claims{}, tt.audience)
+		valid := err == nil && token.Valid
+		if valid != tt.valid {
+			t.Errorf("%s: Parse valid = %v (%v), want %v", tt.name, valid, err, tt.valid)
+		}
+	}
+
+	jwks := ks.JWKS()
+	if len(jwks) != 2 || jwks[0].Kid != "new" || jwks[1].Kid != "old" {
+		t.Errorf("JWKS = %+v, want the keys new and old", jwks)
+	}
+}
+
+func TestLoadKeySetInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[string]bool // kid -> public only
+		active  string
+		retired string
+		err     error
+	}{
+		{"no active key", map[string]bool{"a": false}, "", "", ErrInvalidJWTKeyConfig},
+		{"active key is public only", map[string]bool{"a": true}, "a", "", ErrInvalidJWTKey},
+		{"key neither active nor retired", map[string]bool{"a": false, "b": false}, "a", "", ErrInvalidJWTKeyConfig},
+		{"retired without a time", map[string]bool{"a": false, "b": true}, "a", "b", ErrInvalidJWTKeyConfig},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for kid, publicOnly := range tt.keys {
+			writeEd25519Key(t, dir, kid, publicOnly)
+		}
+		t.Setenv("JWT_KEYS_DIR", dir)
+		t.Setenv("JWT_ACTIVE_KID", tt.active)
+		t.Setenv("JWT_RETIRED_KEYS", tt.retired)
+
+		if _, err := LoadKeySet(time.Hour); !errors.Is(err, tt.err) {
+			t.Errorf("%s: LoadKeySet error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+// labels belong to a single user, they live under /me/labels and are attached to that user's tasks
+// under /me/tasks/{id}/labels/{labelId}
+
+func (s *Server) GetLabelsByUserIdHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetId, ok := ctx.Value(targetIdContextKey).(int)
+	if !ok {
+		log.Println("Error getting target user id from context")
+		http.Error(w, "Unauthorized", http.StatusInternalServerError)
+		return
+	}
+
+	labels, err := s.labelSvc.GetLabelsByUserId(ctx, targetId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting labels: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, newLabelResponses(labels))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) CreateNewLabelHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetId, ok := ctx.Value(targetIdContextKey).(int)
+	if !ok {
+		log.Println("Error getting target user id from context")
+		http.Error(w, "Unauthorized", http.StatusInternalServerError)
+		return
+	}
+
+	var label Label
+
+	if err := json.NewDecoder(r.Body).Decode(&label); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	labelId, err := s.labelSvc.CreateNewLabel(ctx, targetId, label.Name, label.Color)
+	if err != nil {
+		log.Println("Error creating new label: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	labelGotten, err := s.labelSvc.GetLabelById(ctx, labelId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting label by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusCreated)
+
+	err = EncodeJSONhelper(w, newLabelResponse(labelGotten))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) GetLabelByIdHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	label, err := s.labelSvc.GetLabelById(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting label by id: ", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, newLabelResponse(label))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) RenameLabelHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	err = s.labelSvc.RenameLabel(ctx, input.Name, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error renaming label: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	label, err := s.labelSvc.GetLabelById(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting label by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, newLabelResponse(label))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) UpdateLabelColorHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Color string `json:"color"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	err = s.labelSvc.UpdateLabelColor(ctx, input.Color, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error updating label color: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	label, err := s.labelSvc.GetLabelById(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting label by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, newLabelResponse(label))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) DeleteLabelHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.labelSvc.DeleteLabel(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error deleting label: ", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	response := map[string]any{
+		"id":     idInt,
+		"status": "Label successfully deleted",
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) AttachLabelHTTP(w http.ResponseWriter, r *http.Request) {
+	s.changeTaskLabel(w, r, s.labelSvc.AttachLabel)
+}
+
+func (s *Server) DetachLabelHTTP(w http.ResponseWriter, r *http.Request) {
+	s.changeTaskLabel(w, r, s.labelSvc.DetachLabel)
+}
+
+// changeTaskLabel is shared by attach and detach, both respond with the updated task
+func (s *Server) changeTaskLabel(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, taskId int, labelId int, actorId int, actorRole string) error) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	taskId, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	labelId, err := ConvertToInt(chi.URLParam(r, "labelId"))
+	if err != nil {
+		log.Println("Error parsing label id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = change(ctx, taskId, labelId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error changing task labels: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	task, err := s.taskSvc.GetTaskByItsId(ctx, taskId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting task by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, newTaskResponse(task))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
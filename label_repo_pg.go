@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type LabelPgRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewLabelPgRepository(pool *pgxpool.Pool) *LabelPgRepository {
+	return &LabelPgRepository{
+		pool: pool,
+	}
+}
+
+func (lr *LabelPgRepository) GetByUserId(ctx context.Context, userId int, actorId int, actorRole string) ([]Label, error) {
+	query := "SELECT id, user_id, name, color, created_at, updated_at FROM labels WHERE user_id = $1 AND (user_id = $2 OR " + permits("$3", PERM_TASKS_READ_ALL) + ") ORDER BY name"
+	rows, err := lr.pool.Query(ctx, query, userId, actorId, actorRole)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var labels []Label
+	for rows.Next() {
+		var l Label
+		err := rows.Scan(&l.Id, &l.UserId, &l.Name, &l.Color, &l.CreatedAt, &l.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, l)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if labels == nil || len(labels) == 0 {
+		return []Label{}, nil
+	}
+
+	return labels, nil
+}
+
+func (lr *LabelPgRepository) GetById(ctx context.Context, id int, actorId int, actorRole string) (*Label, error) {
+	var l Label
+	query := "SELECT id, user_id, name, color, created_at, updated_at FROM labels WHERE id = $1 AND (user_id = $2 OR " + permits("$3", PERM_TASKS_READ_ALL) + ")"
+	err := lr.pool.QueryRow(ctx, query, id, actorId, actorRole).Scan(&l.Id,
+		&l.UserId,
+		&l.Name,
+		&l.Color,
+		&l.CreatedAt,
+		&l.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrLabelNotFound
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (lr *LabelPgRepository) Create(ctx context.Context, label Label) (int, error) {
+	var id int
+	err := lr.pool.QueryRow(ctx, "INSERT INTO labels (user_id, name, color) VALUES ($1, $2, $3) RETURNING id", label.UserId, label.Name, label.Color).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (lr *LabelPgRepository) Delete(ctx context.Context, id int, actorId int, actorRole string) error {
+	query := "DELETE FROM labels WHERE id = $1 AND (user_id = $2 OR " + permits("$3", PERM_TASKS_WRITE_ALL) + ")"
+	cmdTag, err := lr.pool.Exec(ctx, query, id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return ErrLabelNotFound
+	}
+
+	return nil
+}
+
+func (lr *LabelPgRepository) UpdateName(ctx context.Context, newName string, id int, actorId int, actorRole string) error {
+	query := "UPDATE labels SET name = $1, updated_at = $2 WHERE id = $3 AND (user_id = $4 OR " + permits("$5", PERM_TASKS_WRITE_ALL) + ")"
+	cmdTag, err := lr.pool.Exec(ctx, query, newName, time.Now(), id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return ErrLabelNotFound
+	}
+
+	return nil
+}
+
+func (lr *LabelPgRepository) UpdateColor(ctx context.Context, newColor string, id int, actorId int, actorRole string) error {
+	query := "UPDATE labels SET color = $1, updated_at = $2 WHERE id = $3 AND (user_id = $4 OR " + permits("$5", PERM_TASKS_WRITE_ALL) + ")"
+	cmdTag, err := lr.pool.Exec(ctx, query, newColor, time.Now(), id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return ErrLabelNotFound
+	}
+
+	return nil
+}
+
+// AttachToTask only links a label to a task of the same owner, attaching an already attached label is a no-op.
+// A new link is recorded in the task's history within the same statement
+func (lr *LabelPgRepository) AttachToTask(ctx context.Context, taskId int, labelId int, actorId int, actorRole string) error {
+	query := `WITH target AS (
+		SELECT t.id AS task_id, l.id AS label_id, l.name FROM tasks t JOIN labels l ON l.user_id = t.user_id
+		WHERE t.id = $1 AND l.id = $2 AND (t.user_id = $3 OR ` + permits("$4", PERM_TASKS_WRITE_ALL) + `) AND t.deleted_at IS NULL
+	), inserted AS (
+		INSERT INTO task_labels (task_id, label_id) SELECT task_id, label_id FROM target ON CONFLICT DO NOTHING
+		RETURNING task_id
+	), event AS (
+		INSERT INTO task_events (task_id, actor_id, actor_role, field, new_value, impersonator_id)
+		SELECT target.task_id, $3, $4, $5, target.name, $6 FROM target JOIN inserted ON inserted.task_id = target.task_id
+	)
+	SELECT COUNT(*) FROM target`
+
+	var found int
+	err := lr.pool.QueryRow(ctx, query, taskId, labelId, actorId, actorRole, EVENT_LABEL, eventImpersonator(ctx)).Scan(&found)
+	if err != nil {
+		return err
+	}
+
+	if found == 0 {
+		return ErrLabelNotAttached
+	}
+
+	return nil
+}
+
+func (lr *LabelPgRepository) DetachFromTask(ctx context.Context, taskId int, labelId int, actorId int, actorRole string) error {
+	query := `WITH deleted AS (
+		DELETE FROM task_labels tl USING tasks t
+		WHERE tl.task_id = t.id AND tl.task_id = $1 AND tl.label_id = $2 AND (t.user_id = $3 OR ` + permits("$4", PERM_TASKS_WRITE_ALL) + `) AND t.deleted_at IS NULL
+		RETURNING tl.task_id, tl.label_id
+	), event AS (
+		INSERT INTO task_events (task_id, actor_id, actor_role, field, old_value, impersonator_id)
+		SELECT d.task_id, $3, $4, $5, l.name, $6 FROM deleted d JOIN labels l ON l.id = d.label_id
+	)
+	SELECT COUNT(*) FROM deleted`
+
+	var detached int
+	err := lr.pool.QueryRow(ctx, query, taskId, labelId, actorId, actorRole, EVENT_LABEL, eventImpersonator(ctx)).Scan(&detached)
+	if err != nil {
+		return err
+	}
+
+	if detached == 0 {
+		return ErrLabelNotDetached
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+var hexColorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type LabelService struct {
+	repo LabelRepository
+}
+
+func NewLabelService(repo LabelRepository) *LabelService {
+	return &LabelService{repo: repo}
+}
+
+func validateLabelName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ErrEmptyLabelName
+	}
+	if len([]rune(name)) > MAX_LABEL_NAME_LEN {
+		return "", ErrLabelNameTooLong
+	}
+	return name, nil
+}
+
+func (ls *LabelService) GetLabelsByUserId(ctx context.Context, userId int, actorId int, actorRole string) ([]Label, error) {
+	if userId < 1 {
+		return nil, ErrIdMustBeGtZero
+	}
+	return ls.repo.GetByUserId(ctx, userId, actorId, actorRole)
+}
+
+func (ls *LabelService) GetLabelById(ctx context.Context, id int, actorId int, actorRole string) (*Label, error) {
+	if id < 1 {
+		return nil, ErrIdMustBeGtZero
+	}
+	return ls.repo.GetById(ctx, id, actorId, actorRole)
+}
+
+func (ls *LabelService) CreateNewLabel(ctx context.Context, userId int, name string, color string) (int, error) {
+	if userId < 1 {
+		return 0, ErrIdMustBeGtZero
+	}
+	name, err := validateLabelName(name)
+	if err != nil {
+		return 0, err
+	}
+	if color == "" {
+		color = DEFAULT_COLOR
+	}
+	if !hexColorRegexp.MatchString(color) {
+		return 0, ErrInvalidColor
+	}
+
+	id, err := ls.repo.Create(ctx, Label{UserId: userId, Name: name, Color: strings.ToLower(color)})
+	if err != nil {
+		if IsUniqueViolation(err) {
+			return 0, ErrLabelNameTaken
+		}
+		if IsForeignKeyViolation(err) {
+			return 0, ErrNoUserWithThisId
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+func (ls *LabelService) RenameLabel(ctx context.Context, newName string, id int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+	newName, err := validateLabelName(newName)
+	if err != nil {
+		return err
+	}
+
+	err = ls.repo.UpdateName(ctx, newName, id, actorId, actorRole)
+	if IsUniqueViolation(err) {
+		return ErrLabelNameTaken
+	}
+	return err
+}
+
+func (ls *LabelService) UpdateLabelColor(ctx context.Context, newColor string, id int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+	if !hexColorRegexp.MatchString(newColor) {
+		return ErrInvalidColor
+	}
+	return ls.repo.UpdateColor(ctx, strings.ToLower(newColor), id, actorId, actorRole)
+}
+
+func (ls *LabelService) DeleteLabel(ctx context.Context, id int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+	return ls.repo.Delete(ctx, id, actorId, actorRole)
+}
+
+func (ls *LabelService) AttachLabel(ctx context.Context, taskId int, labelId int, actorId int, actorRole string) error {
+	if taskId < 1 || labelId < 1 {
+		return ErrIdMustBeGtZero
+	}
+	return ls.repo.AttachToTask(ctx, taskId, labelId, actorId, actorRole)
+}
+
+func (ls *LabelService) DetachLabel(ctx context.Context, taskId int, labelId int, actorId int, actorRole string) error {
+	if taskId < 1 || labelId < 1 {
+		return ErrIdMustBeGtZero
+	}
+	return ls.repo.DetachFromTask(ctx, taskId, labelId, actorId, actorRole)
+}
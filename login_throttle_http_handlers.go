@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+// admins see the usernames and IPs with failed logins under /admin/lockouts and can let them log in again
+
+func (s *Server) GetLockoutsHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	lockouts, err := s.throttleSvc.GetLockouts(ctx)
+	if err != nil {
+		log.Println("Error getting lockouts: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, lockouts)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// lockoutKindFromURL maps the {kind} of a lockout URL to THROTTLE_USER, THROTTLE_NAME or THROTTLE_IP, empty when unknown
+func lockoutKindFromURL(r *http.Request) string {
+	switch chi.URLParam(r, "kind") {
+	case "users":
+		return THROTTLE_USER
+	case "names":
+		return THROTTLE_NAME
+	case "ips":
+		return THROTTLE_IP
+	}
+	return ""
+}
+
+// ClearLockoutHTTP handles DELETE /admin/lockouts/users/{id}, /admin/lockouts/names/{name} and /admin/lockouts/ips/{ip}
+func (s *Server) ClearLockoutHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	kind := lockoutKindFromURL(r)
+	key := chi.URLParam(r, "key")
+
+	err := s.throttleSvc.ClearLockout(ctx, kind, key)
+	if err != nil {
+		log.Println("Error clearing lockout: ", err)
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrInvalidThrottleKind):
+			status = http.StatusBadRequest
+		case errors.Is(err, ErrLockoutNotFound):
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	response := map[string]any{
+		"kind":   kind,
+		"key":    key,
+		"status": "Lockout cleared",
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
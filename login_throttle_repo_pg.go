@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type LoginThrottlePgRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewLoginThrottlePgRepository(pool *pgxpool.Pool) *LoginThrottlePgRepository {
+	return &LoginThrottlePgRepository{
+		pool: pool,
+	}
+}
+
+// GetLocked returns the latest locked_until among the kind -> key pairs that are locked at now, nil when none is
+func (lr *LoginThrottlePgRepository) GetLocked(ctx context.Context, keys map[string]string, now time.Time) (*time.Time, error) {
+	kinds := make([]string, 0, len(keys))
+	values := make([]string, 0, len(keys))
+	for kind, key := range keys {
+		kinds = append(kinds, kind)
+		values = append(values, key)
+	}
+
+	var lockedUntil *time.Time
+	query := `SELECT MAX(locked_until) FROM login_throttles
+		WHERE (kind, key) IN (SELECT * FROM unnest($1::text[], $2::text[])) AND locked_until > $3`
+	err := lr.pool.QueryRow(ctx, query, kinds, values, now).Scan(&lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return lockedUntil, nil
+}
+
+// RecordFailure counts a failed login and returns the failures in a row, failures older than window
+// start the count over. Stale rows of other keys are dropped on the way
+func (lr *LoginThrottlePgRepository) RecordFailure(ctx context.Context, kind string, key string, now time.Time, window time.Duration) (int, error) {
+	tx, err := lr.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM login_throttles WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < $2)", now.Add(-window), now)
+	if err != nil {
+		return 0, err
+	}
+
+	var failures int
+	query := `INSERT INTO login_throttles (kind, key, failures, last_failure_at) VALUES ($1, $2, 1, $3)
+		ON CONFLICT (kind, key) DO UPDATE SET failures = login_throttles.failures + 1, last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures`
+	err = tx.QueryRow(ctx, query, kind, key, now).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return failures, nil
+}
+
+func (lr *LoginThrottlePgRepository) Lock(ctx context.Context, kind string, key string, until time.Time) error {
+	_, err := lr.pool.Exec(ctx, "UPDATE login_throttles SET locked_until = $1 WHERE kind = $2 AND key = $3", until, kind, key)
+	return err
+}
+
+func (lr *LoginThrottlePgRepository) Clear(ctx context.Context, kind string, key string) error {
+	cmdTag, err := lr.pool.Exec(ctx, "DELETE FROM login_throttles WHERE kind = $1 AND key = $2", kind, key)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrLockoutNotFound
+	}
+	return nil
+}
+
+// GetAll lists the keys that failed since the given time or are still locked, the locked ones first
+func (lr *LoginThrottlePgRepository) GetAll(ctx context.Context, since time.Time) ([]LoginThrottle, error) {
+	query := `SELECT kind, key, failures, last_failure_at, locked_until FROM login_throttles
+		WHERE last_failure_at >= $1 OR locked_until > NOW()
+		ORDER BY locked_until DESC NULLS LAST, last_failure_at DESC`
+	rows, err := lr.pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	throttles := []LoginThrottle{}
+	for rows.Next() {
+		var t LoginThrottle
+		if err := rows.Scan(&t.Kind, &t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil); err != nil {
+			return nil, err
+		}
+		throttles = append(throttles, t)
+	}
+	return throttles, rows.Err()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// LoginThrottleService slows down password guessing: failed logins are counted per account and per
+// client IP, and a throttled account or IP can't log in at all until its wait is over, not even with
+// the right password
+type LoginThrottleService struct {
+	repo LoginThrottleRepository
+}
+
+func NewLoginThrottleService(repo LoginThrottleRepository) *LoginThrottleService {
+	return &LoginThrottleService{repo: repo}
+}
+
+// ThrottledError is returned instead of ErrTooManyLoginAttempts so handlers can send Retry-After
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return ErrTooManyLoginAttempts.Error()
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return ErrTooManyLoginAttempts
+}
+
+// throttleAccount is the kind and key the failures of a login are counted under: the account the name or
+// email resolved to (userId), so every way of typing it shares one count, or the name as typed when
+// userId is 0 because no account matches
+func throttleAccount(userId int, name string) (string, string) {
+	if userId > 0 {
+		return THROTTLE_USER, strconv.Itoa(userId)
+	}
+	return THROTTLE_NAME, name
+}
+
+// Check returns a *ThrottledError while the account or the IP has to wait
+func (lt *LoginThrottleService) Check(ctx context.Context, userId int, name string, ip string) error {
+	now := time.Now()
+	kind, key := throttleAccount(userId, name)
+	lockedUntil, err := lt.repo.GetLocked(ctx, map[string]string{kind: key, THROTTLE_IP: ip}, now)
+	if err != nil {
+		return err
+	}
+	if lockedUntil != nil {
+		return &ThrottledError{RetryAfter: lockedUntil.Sub(now)}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login for both the account and the IP
+func (lt *LoginThrottleService) RecordFailure(ctx context.Context, userId int, name string, ip string) error {
+	kind, key := throttleAccount(userId, name)
+	if err := lt.recordFailure(ctx, kind, key, LOGIN_FREE_ATTEMPTS_USER, LOGIN_LOCKOUT_USER); err != nil {
+		return err
+	}
+	return lt.recordFailure(ctx, THROTTLE_IP, ip, LOGIN_FREE_ATTEMPTS_IP, LOGIN_LOCKOUT_IP)
+}
+
+func (lt *LoginThrottleService) recordFailure(ctx context.Context, kind string, key string, freeAttempts int, lockoutAfter int) error {
+	now := time.Now()
+	failures, err := lt.repo.RecordFailure(ctx, kind, key, now, LOGIN_FAILURE_WINDOW)
+	if err != nil {
+		return err
+	}
+	if failures <= freeAttempts {
+		return nil
+	}
+	return lt.repo.Lock(ctx, kind, key, now.Add(loginDelay(failures-freeAttempts, failures >= lockoutAfter)))
+}
+
+// loginDelay doubles with every failure past the free attempts, up to LOGIN_LOCKOUT
+func loginDelay(extraFailures int, lockedOut bool) time.Duration {
+	if lockedOut || extraFailures > 20 {
+		return LOGIN_LOCKOUT
+	}
+	return min(LOGIN_BASE_DELAY<<(extraFailures-1), LOGIN_LOCKOUT)
+}
+
+// RecordSuccess forgets the failures of the account, the IP keeps its count so one valid account
+// can't be used to reset the throttle of an IP guessing other accounts
+func (lt *LoginThrottleService) RecordSuccess(ctx context.Context, userId int) error {
+	err := lt.repo.Clear(ctx, THROTTLE_USER, strconv.Itoa(userId))
+	if errors.Is(err, ErrLockoutNotFound) {
+		return nil
+	}
+	return err
+}
+
+// GetLockouts lists the accounts, names and IPs with recent failures, the locked ones first
+func (lt *LoginThrottleService) GetLockouts(ctx context.Context) ([]LoginThrottle, error) {
+	return lt.repo.GetAll(ctx, time.Now().Add(-LOGIN_FAILURE_WINDOW))
+}
+
+// ClearLockout lets an account, a name or an IP log in again right away
+func (lt *LoginThrottleService) ClearLockout(ctx context.Context, kind string, key string) error {
+	switch kind {
+	case THROTTLE_USER, THROTTLE_NAME, THROTTLE_IP:
+	default:
+		return ErrInvalidThrottleKind
+	}
+	return lt.repo.Clear(ctx, kind, key)
+}
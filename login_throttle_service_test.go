@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottleAccount(t *testing.T) {
+	tests := []struct {
+		userId int
+		name   string
+		kind   string
+		key    string
+	}{
+		// the name and the email of one account share its count
+		{7, "alice", THROTTLE_USER, "7"},
+		{7, "Alice@Example.com", THROTTLE_USER, "7"},
+		// names that match no account are counted as typed, distinct names never share a count
+		{0, "Alice", THROTTLE_NAME, "Alice"},
+		{0, "alice", THROTTLE_NAME, "alice"},
+		{0, "7", THROTTLE_NAME, "7"},
+	}
+
+	for _, tt := range tests {
+		kind, key := throttleAccount(tt.userId, tt.name)
+		if kind != tt.kind || key != tt.key {
+			t.Errorf("throttleAccount(%d, %q) = %q, %q, want %q, %q", tt.userId, tt.name, kind, key, tt.kind, tt.key)
+		}
+	}
+}
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		extraFailures int
+		lockedOut     bool
+		want          time.Duration
+	}{
+		{1, false, LOGIN_BASE_DELAY},
+		{3, false, 4 * LOGIN_BASE_DELAY},
+		{40, false, LOGIN_LOCKOUT},
+		{1, true, LOGIN_LOCKOUT},
+	}
+
+	for _, tt := range tests {
+		if got := loginDelay(tt.extraFailures, tt.lockedOut); got != tt.want {
+			t.Errorf("loginDelay(%d, %v) = %v, want %v", tt.extraFailures, tt.lockedOut, got, tt.want)
+		}
+	}
+}
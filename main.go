@@ -10,12 +10,52 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // the ?tz= task filter needs the IANA database even on slim images
 )
 
 func InitConfingEnv() error {
 	return godotenv.Load("config.env")
 }
 
+// durationFromEnv reads a Go duration like 720h from the env var key, def is used when it is not set
+func durationFromEnv(key string, def time.Duration) (time.Duration, bool) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, true
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// trashPurgeConfig reads TRASH_RETENTION and TRASH_PURGE_INTERVAL
+func trashPurgeConfig() (time.Duration, time.Duration, error) {
+	retention, ok := durationFromEnv("TRASH_RETENTION", DEFAULT_TRASH_RETENTION)
+	if !ok {
+		return 0, 0, ErrInvalidTrashConfig
+	}
+	interval, ok := durationFromEnv("TRASH_PURGE_INTERVAL", DEFAULT_TRASH_PURGE_INTERVAL)
+	if !ok {
+		return 0, 0, ErrInvalidTrashConfig
+	}
+	return retention, interval, nil
+}
+
+// tokenTTLConfig reads ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL
+func tokenTTLConfig() (time.Duration, time.Duration, error) {
+	accessTTL, ok := durationFromEnv("ACCESS_TOKEN_TTL", DEFAULT_ACCESS_TOKEN_TTL)
+	if !ok {
+		return 0, 0, ErrInvalidTokenTTL
+	}
+	refreshTTL, ok := durationFromEnv("REFRESH_TOKEN_TTL", DEFAULT_REFRESH_TOKEN_TTL)
+	if !ok {
+		return 0, 0, ErrInvalidTokenTTL
+	}
+	return accessTTL, refreshTTL, nil
+}
+
 func main() {
 
 	if err := InitConfingEnv(); err != nil {
@@ -45,10 +85,54 @@ func main() {
 
 	// TODO : SERVER STRUCT W/ CHI AND SERVICES
 
-	userService := NewUserService(NewUserPgRepository(pool))
+	hasher, err := NewPasswordHasherFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy, err := NewPasswordPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	refreshTokens := NewRefreshTokenPgRepository(pool)
+	userService := NewUserService(NewUserPgRepository(pool), hasher, policy, refreshTokens)
 	taskService := NewTaskService(NewTaskPgRepository(pool))
+	labelService := NewLabelService(NewLabelPgRepository(pool))
+	itemService := NewTaskItemService(NewTaskItemPgRepository(pool))
+	projectService := NewProjectService(NewProjectPgRepository(pool))
+
+	accessTTL, refreshTTL, err := tokenTTLConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// a retired key has to verify every token it signed until it expires, verification links live longest
+	keys, err := LoadKeySet(max(accessTTL, IMPERSONATION_TTL, TWO_FACTOR_CHALLENGE_TTL, EMAIL_VERIFICATION_TTL))
+	if err != nil {
+		log.Fatal(err)
+	}
+	settingsService := NewSettingsService(NewSettingsPgRepository(pool))
+	roleService := NewRoleService(NewRolePgRepository(pool))
+	twoFactorService := NewTwoFactorService(NewTwoFactorPgRepository(pool), settingsService, roleService)
+	throttleService := NewLoginThrottleService(NewLoginThrottlePgRepository(pool))
+	authService := NewAuthService(userService, twoFactorService, throttleService, refreshTokens, keys, accessTTL, refreshTTL)
+
+	patService := NewPersonalAccessTokenService(NewPersonalAccessTokenPgRepository(pool))
 
-	srv := NewServer(userService, taskService)
+	notifier, err := NewNotifierFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	emailService := NewEmailService(userService, keys, notifier, os.Getenv("EMAIL_VERIFICATION_URL"))
+	resetService := NewPasswordResetService(userService, NewPasswordResetPgRepository(pool), refreshTokens, notifier, os.Getenv("PASSWORD_RESET_URL"))
+
+	auditService := NewAdminAuditService(NewAdminAuditPgRepository(pool))
+
+	srv := NewServer(userService, taskService, labelService, itemService, projectService, authService, keys, patService, twoFactorService, settingsService, throttleService, resetService, emailService, roleService, auditService)
+
+	retention, purgeInterval, err := trashPurgeConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	go taskService.RunTrashPurge(ctx, retention, purgeInterval)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,2 @@
+ALTER TABLE tasks ADD COLUMN due_date TIMESTAMPTZ;
+CREATE INDEX tasks_user_id_due_date_idx ON tasks (user_id, due_date) WHERE due_date IS NOT NULL;
@@ -0,0 +1,4 @@
+CREATE TYPE task_priority AS ENUM ('none', 'low', 'medium', 'high', 'urgent');
+ALTER TABLE tasks
+ADD COLUMN priority task_priority NOT NULL DEFAULT 'none';
+CREATE INDEX tasks_user_id_priority_idx ON tasks (user_id, priority DESC, due_date);
@@ -0,0 +1,16 @@
+CREATE TABLE projects (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    color VARCHAR(7) NOT NULL DEFAULT '#9e9e9e',
+    is_archived BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX projects_user_id_idx ON projects (user_id);
+
+ALTER TABLE tasks
+ADD COLUMN project_id BIGINT REFERENCES projects(id) ON DELETE CASCADE;
+
+CREATE INDEX tasks_project_id_idx ON tasks (project_id);
@@ -0,0 +1,4 @@
+DROP INDEX tasks_recurrence_parent_id_key;
+ALTER TABLE tasks
+DROP COLUMN recurrence_parent_id,
+DROP COLUMN recurrence;
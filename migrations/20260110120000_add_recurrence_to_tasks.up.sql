@@ -0,0 +1,6 @@
+ALTER TABLE tasks
+ADD COLUMN recurrence TEXT,
+ADD COLUMN recurrence_parent_id BIGINT REFERENCES tasks(id) ON DELETE SET NULL;
+
+-- every occurrence spawns at most one follow-up, even if it is completed, reopened and completed again
+CREATE UNIQUE INDEX tasks_recurrence_parent_id_key ON tasks (recurrence_parent_id) WHERE recurrence_parent_id IS NOT NULL;
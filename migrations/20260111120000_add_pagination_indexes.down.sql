@@ -0,0 +1,5 @@
+DROP INDEX users_created_at_idx;
+DROP INDEX tasks_created_at_idx;
+DROP INDEX tasks_user_id_updated_at_idx;
+DROP INDEX tasks_user_id_created_at_idx;
+DROP INDEX tasks_user_id_id_idx;
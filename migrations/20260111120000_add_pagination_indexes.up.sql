@@ -0,0 +1,6 @@
+-- keyset pagination walks these indexes instead of sorting whole tables
+CREATE INDEX tasks_user_id_id_idx ON tasks (user_id, id);
+CREATE INDEX tasks_user_id_created_at_idx ON tasks (user_id, created_at DESC, id DESC);
+CREATE INDEX tasks_user_id_updated_at_idx ON tasks (user_id, updated_at DESC, id DESC);
+CREATE INDEX tasks_created_at_idx ON tasks (created_at DESC, id DESC);
+CREATE INDEX users_created_at_idx ON users (created_at DESC, id DESC);
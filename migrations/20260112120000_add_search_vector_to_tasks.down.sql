@@ -0,0 +1,2 @@
+DROP INDEX tasks_search_vector_idx;
+ALTER TABLE tasks DROP COLUMN search_vector;
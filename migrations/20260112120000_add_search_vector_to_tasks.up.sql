@@ -0,0 +1,8 @@
+-- 'simple' does no stemming, it works the same for russian and english titles
+ALTER TABLE tasks
+ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(description, '')), 'B')
+) STORED;
+
+CREATE INDEX tasks_search_vector_idx ON tasks USING GIN (search_vector);
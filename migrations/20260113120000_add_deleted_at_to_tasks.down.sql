@@ -0,0 +1,2 @@
+DROP INDEX tasks_user_id_deleted_at_idx;
+ALTER TABLE tasks DROP COLUMN deleted_at;
@@ -0,0 +1,4 @@
+-- deleted tasks stay in the trash until they are restored, deleted for good or purged
+ALTER TABLE tasks ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX tasks_user_id_deleted_at_idx ON tasks (user_id, deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,12 @@
+CREATE TABLE task_events (
+    id BIGSERIAL PRIMARY KEY,
+    task_id BIGINT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL, -- kept as NULL once the actor's account is deleted
+    actor_role TEXT NOT NULL, -- the role the actor had when making the change
+    field TEXT NOT NULL, -- a tasks column, 'created' or 'label'
+    old_value TEXT,
+    new_value TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX task_events_task_id_idx ON task_events (task_id, id);
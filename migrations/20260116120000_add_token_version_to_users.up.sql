@@ -0,0 +1,2 @@
+-- bumped on every password or role change, access tokens carrying an older version are rejected
+ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+ALTER TABLE personal_access_tokens DROP COLUMN mfa;
+ALTER TABLE refresh_tokens DROP COLUMN mfa;
+DROP TABLE app_settings;
+DROP TABLE recovery_codes;
+DROP TABLE user_totp;
@@ -0,0 +1,31 @@
+CREATE TABLE user_totp (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL, -- base32 RFC 6238 secret
+    confirmed_at TIMESTAMPTZ, -- NULL while enrollment waits for the first code
+    last_used_step BIGINT NOT NULL DEFAULT 0, -- a code is accepted once, codes of this or earlier steps are replays
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL, -- sha256 of the code
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+-- settings admins change at runtime
+CREATE TABLE app_settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO app_settings (key, value) VALUES ('require_admin_2fa', 'false');
+
+-- whether the session or token was started with a second factor
+ALTER TABLE refresh_tokens ADD COLUMN mfa BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE personal_access_tokens ADD COLUMN mfa BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,11 @@
+-- failed logins per username and per client IP, see LoginThrottleService
+CREATE TABLE login_throttles (
+    kind TEXT NOT NULL, -- 'user' or 'ip'
+    key TEXT NOT NULL, -- the username or the IP
+    failures INTEGER NOT NULL DEFAULT 0, -- failed logins in a row within LOGIN_FAILURE_WINDOW
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ,
+    PRIMARY KEY (kind, key)
+);
+
+CREATE INDEX login_throttles_last_failure_at_idx ON login_throttles (last_failure_at);
@@ -0,0 +1,4 @@
+-- emails are stored lower-cased, so the UNIQUE constraint ignores case
+ALTER TABLE users
+    ADD COLUMN email TEXT UNIQUE CHECK (email = lower(email)),
+    ADD COLUMN email_verified_at TIMESTAMPTZ;
@@ -0,0 +1,10 @@
+-- users with a custom role go back to being regular users
+CREATE TYPE user_role AS ENUM ('user', 'admin');
+ALTER TABLE users DROP CONSTRAINT users_role_fkey;
+UPDATE users SET role = 'user' WHERE role NOT IN ('user', 'admin');
+ALTER TABLE users ALTER COLUMN role DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN role TYPE user_role USING role::user_role;
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'user';
+DROP TABLE role_permissions;
+DROP TABLE permissions;
+DROP TABLE roles;
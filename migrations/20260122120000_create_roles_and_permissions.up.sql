@@ -0,0 +1,61 @@
+-- roles replace the user_role enum, what a role may do is the set of its permissions.
+-- admin has every permission and user none, both can't be changed or deleted
+CREATE TABLE roles (
+    name TEXT PRIMARY KEY CHECK (name ~ '^[a-z][a-z0-9_-]{0,31}$'),
+    description TEXT NOT NULL DEFAULT '',
+    builtin BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE permissions (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL
+);
+
+CREATE TABLE role_permissions (
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users.read', 'list users and see any user'),
+    ('users.create', 'create users'),
+    ('users.update', 'rename users, change their password or email and reset their 2FA'),
+    ('users.delete', 'delete users'),
+    ('roles.read', 'list roles and their permissions'),
+    ('roles.manage', 'create, change and delete roles and assign them to users'),
+    ('tasks.read_all', 'see the tasks, checklists, labels and projects of any user'),
+    ('tasks.write_all', 'change the tasks, checklists, labels and projects of any user'),
+    ('lockouts.read', 'list login lockouts'),
+    ('lockouts.clear', 'clear login lockouts'),
+    ('settings.read', 'see the app settings'),
+    ('settings.update', 'change the app settings');
+
+INSERT INTO roles (name, description, builtin) VALUES
+    ('user', 'regular user, only has access to their own data', TRUE),
+    ('admin', 'has every permission', TRUE),
+    ('auditor', 'read-only access to users, tasks, lockouts and settings', FALSE),
+    ('support', 'helps users with their account, can''t delete them or change roles', FALSE);
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name FROM permissions;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('auditor', 'users.read'),
+    ('auditor', 'roles.read'),
+    ('auditor', 'tasks.read_all'),
+    ('auditor', 'lockouts.read'),
+    ('auditor', 'settings.read'),
+    ('support', 'users.read'),
+    ('support', 'users.update'),
+    ('support', 'tasks.read_all'),
+    ('support', 'lockouts.read'),
+    ('support', 'lockouts.clear');
+
+ALTER TABLE users ALTER COLUMN role DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN role TYPE TEXT USING role::text;
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'user';
+ALTER TABLE users ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name);
+DROP TYPE user_role;
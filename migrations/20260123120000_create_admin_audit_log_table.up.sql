@@ -0,0 +1,21 @@
+-- every privileged action, who did it to what. actor_name and actor_role are copied so the entry
+-- still tells who it was once the actor is renamed, loses the role or is deleted
+CREATE TABLE admin_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    actor_name TEXT NOT NULL,
+    actor_role TEXT NOT NULL,
+    action TEXT NOT NULL, -- like 'user.role'
+    target_type TEXT NOT NULL, -- 'user', 'task', 'role', ...
+    target_id TEXT NOT NULL,
+    old_value JSONB,
+    new_value JSONB,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX admin_audit_log_created_at_idx ON admin_audit_log (created_at DESC, id DESC);
+CREATE INDEX admin_audit_log_actor_id_idx ON admin_audit_log (actor_id);
+CREATE INDEX admin_audit_log_target_idx ON admin_audit_log (target_type, target_id);
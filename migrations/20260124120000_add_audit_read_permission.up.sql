@@ -0,0 +1,8 @@
+-- reading admin_audit_log is a permission of its own, admin has every permission and auditors read
+INSERT INTO permissions (name, description) VALUES
+    ('audit.read', 'list and export the admin audit log');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'audit.read'),
+    ('auditor', 'audit.read')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+-- role_permissions rows go with it
+DELETE FROM permissions WHERE name = 'users.impersonate';
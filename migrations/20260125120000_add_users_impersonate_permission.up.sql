@@ -0,0 +1,7 @@
+-- acting as another user is only granted to admin, custom roles can be given it like any permission
+INSERT INTO permissions (name, description) VALUES
+    ('users.impersonate', 'act as another user through /me with a short-lived token');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users.impersonate')
+ON CONFLICT DO NOTHING;
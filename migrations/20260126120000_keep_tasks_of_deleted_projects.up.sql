@@ -0,0 +1,3 @@
+-- deleting a project moves its tasks into the trash, trashed tasks stay there without a project
+ALTER TABLE tasks DROP CONSTRAINT tasks_project_id_fkey;
+ALTER TABLE tasks ADD CONSTRAINT tasks_project_id_fkey FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL;
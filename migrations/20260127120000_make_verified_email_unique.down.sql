@@ -0,0 +1,3 @@
+-- fails while two accounts share an unverified email
+DROP INDEX users_verified_email_key;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
@@ -0,0 +1,4 @@
+-- an address belongs to one account only once it is verified, so nobody can claim another's address
+-- by adding it unverified first
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+CREATE UNIQUE INDEX users_verified_email_key ON users (email) WHERE email_verified_at IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE task_events DROP COLUMN impersonator_id;
@@ -0,0 +1,2 @@
+-- changes made with an impersonation token name the impersonated user as actor and the staff member here
+ALTER TABLE task_events ADD COLUMN impersonator_id BIGINT REFERENCES users(id) ON DELETE SET NULL;
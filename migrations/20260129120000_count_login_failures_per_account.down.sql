@@ -0,0 +1 @@
+DELETE FROM login_throttles WHERE kind IN ('user', 'name');
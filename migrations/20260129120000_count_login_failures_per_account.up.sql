@@ -0,0 +1,2 @@
+-- user throttles are keyed by user id now instead of the name as typed, the old counts are dropped
+DELETE FROM login_throttles WHERE kind = 'user';
@@ -2,21 +2,222 @@ package main
 
 import "time"
 
+// User is a users row, the API shows it as a UserResponse, see dto.go
 type User struct {
+	Id        int
+	Name      string
+	Password  string `json:"-"` // the hash, see PasswordHasher
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Role      string
+
+	Email           *string    // lower-cased, nil when the user has none
+	EmailVerifiedAt *time.Time // nil until the user opened the verification link
+
+	TokenVersion int `json:"-"` // bumped on every password or role change, see JWTmiddleware
+}
+
+// Task is a tasks row with its labels and checklist progress, the API shows it as a TaskResponse
+type Task struct {
+	Id          int
+	UserId      int
+	ProjectId   *int
+	Title       string
+	Description string
+	IsCompleted bool
+	DueDate     *time.Time
+	Priority    string
+	Recurrence  *string // RRULE subset, see Recurrence
+	Labels      []Label
+	ItemsTotal  int // checklist progress: ItemsDone of ItemsTotal items are completed
+	ItemsDone   int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time // set while the task is in the trash
+}
+
+// TaskSearchResult is a task matching a search query, the highlights are HTML escaped with the matches wrapped in <mark></mark>
+type TaskSearchResult struct {
+	Task
+	Rank           float32
+	TitleHighlight string
+	Snippet        string // the best matching fragments of the description
+}
+
+// TaskEvent is one recorded change of a task, Field is the changed task field or one of the EVENT_* values
+type TaskEvent struct {
+	Id        int     `json:"id"`
+	TaskId    int     `json:"task_id"`
+	ActorId   *int    `json:"actor_id"` // null once the actor's account is deleted
+	ActorName *string `json:"actor_name"`
+	ActorRole string  `json:"actor_role"` // the role the actor had at the time
+	// the staff member who made the change with an impersonation token, null otherwise
+	ImpersonatorId   *int      `json:"impersonator_id"`
+	ImpersonatorName *string   `json:"impersonator_name"`
+	Field            string    `json:"field"`
+	OldValue         *string   `json:"old_value"`
+	NewValue         *string   `json:"new_value"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// RefreshToken is a stored refresh token, only the sha256 of the token itself is kept.
+// Tokens rotated out of the same login share FamilyId
+type RefreshToken struct {
+	Id        int
+	UserId    int
+	FamilyId  string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	MFA       bool // the login passed the second factor
+	CreatedAt time.Time
+}
+
+// PasswordResetToken lets a user who forgot their password set a new one, it works once.
+// Only the sha256 of the token is stored
+type PasswordResetToken struct {
+	Id        int
+	UserId    int
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// PersonalAccessToken lets scripts call the API as a user with a subset of their rights, see RequireScope.
+// Only the sha256 of the token is stored, the token itself is returned once when it is created
+type PersonalAccessToken struct {
+	Id         int        `json:"id"`
+	UserId     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	MFA        bool       `json:"-"` // created from a session that passed the second factor
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TwoFactor is a user's TOTP enrollment, it is enabled once ConfirmedAt is set
+type TwoFactor struct {
+	UserId         int
+	Secret         string
+	ConfirmedAt    *time.Time
+	LastUsedStep   int64
+	FailedAttempts int
+	LockedUntil    *time.Time
+}
+
+// TwoFactorStatus is what /me/2fa reports
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+	Required          bool `json:"required"` // the user has a staff role and require_admin_2fa is on
+}
+
+// LoginThrottle counts the failed logins of a username or a client IP, see LoginThrottleService
+type LoginThrottle struct {
+	Kind          string     `json:"kind"` // THROTTLE_USER, THROTTLE_NAME or THROTTLE_IP
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// TaskItem is a single checklist entry of a task, items are ordered by Position starting at 0
+type TaskItem struct {
+	Id          int       `json:"id"`
+	TaskId      int       `json:"task_id"`
+	Title       string    `json:"title"`
+	IsCompleted bool      `json:"is_completed"`
+	Position    int       `json:"position"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Project groups tasks of a single user, deleting it deletes its tasks unless they are reassigned first
+type Project struct {
+	Id         int       `json:"id"`
+	UserId     int       `json:"user_id"`
+	Name       string    `json:"name"`
+	Color      string    `json:"color"`
+	IsArchived bool      `json:"is_archived"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type Label struct {
 	Id        int       `json:"id"`
+	UserId    int       `json:"user_id"`
 	Name      string    `json:"name"`
-	Password  string    `json:"password"`
+	Color     string    `json:"color"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
-	Role      string    `json:"role"`
 }
 
-type Task struct {
-	Id          int       `json:"id"`
-	UserId      int       `json:"user_id"`
-	Title       string    `json:"title"`
+// Role is a named set of permissions, every user has exactly one
+type Role struct {
+	Name        string    `json:"name"`
 	Description string    `json:"description"`
-	IsCompleted bool      `json:"is_completed"`
+	Builtin     bool      `json:"builtin"` // user and admin, they can't be changed or deleted
+	Permissions []string  `json:"permissions"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AuditEntry is one privileged action in admin_audit_log. old_value and new_value hold the fields
+// the action changed, as they were before and after
+type AuditEntry struct {
+	Id         int            `json:"id"`
+	ActorId    int            `json:"actor_id"` // 0 once the actor's account is deleted
+	ActorName  string         `json:"actor_name"`
+	ActorRole  string         `json:"actor_role"`
+	Action     string         `json:"action"`
+	TargetType string         `json:"target_type"`
+	TargetId   string         `json:"target_id"`
+	OldValue   map[string]any `json:"old_value"`
+	NewValue   map[string]any `json:"new_value"`
+	IP         string         `json:"ip"`
+	UserAgent  string         `json:"user_agent"`
+	RequestId  string         `json:"request_id"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// TaskFilter narrows down task listings, the zero value returns the first page of every task outside of the trash
+type TaskFilter struct {
+	PageParams               // Sort is one of the SORT_* task orders
+	Trashed       bool       // list the trash instead of the live tasks
+	DueFrom       *time.Time // only tasks due at or after this moment
+	DueBefore     *time.Time // only tasks due strictly before this moment
+	OnlyOpen      bool       // skip completed tasks
+	Completed     *bool      // only completed (true) or only open (false) tasks
+	CreatedAfter  *time.Time // only tasks created strictly after this moment
+	UpdatedBefore *time.Time // only tasks last updated strictly before this moment
+	LabelIds      []int      // only tasks carrying at least one of these labels
+	ProjectId     *int       // only tasks of this project
+}
+
+// UserFilter narrows down the user listing, the zero value returns the first page of every user
+type UserFilter struct {
+	PageParams               // Sort is one of SORT_ID, SORT_NAME, SORT_CREATED, SORT_UPDATED
+	CreatedAfter  *time.Time // only users created strictly after this moment
+	UpdatedBefore *time.Time // only users last updated strictly before this moment
+}
+
+// AuditFilter narrows down the admin audit log, the zero value returns the first page of every entry, newest first
+type AuditFilter struct {
+	PageParams               // Sort must be empty, Order flips the time order
+	ActorId       *int       // only actions of this user
+	Action        string     // only this action, one of the AUDIT_ACTION_* constants
+	TargetType    string     // only actions on this kind of target, one of the AUDIT_TARGET_* constants
+	TargetId      string     // only actions on this target, usually with TargetType
+	CreatedAfter  *time.Time // only entries recorded strictly after this moment
+	CreatedBefore *time.Time // only entries recorded strictly before this moment
+}
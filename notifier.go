@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text message to a user, To is an email address for the SMTP backend
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// NewNotifierFromEnv picks the backend from NOTIFIER: log (the default), file or smtp.
+// The log and file backends are for local dev, they keep reset links readable by anyone with the logs
+func NewNotifierFromEnv() (Notifier, error) {
+	switch os.Getenv("NOTIFIER") {
+	case "", NOTIFIER_LOG:
+		return LogNotifier{}, nil
+	case NOTIFIER_FILE:
+		path := os.Getenv("NOTIFIER_FILE")
+		if path == "" {
+			path = DEFAULT_NOTIFIER_FILE
+		}
+		return NewFileNotifier(path), nil
+	case NOTIFIER_SMTP:
+		host, from := os.Getenv("SMTP_HOST"), os.Getenv("SMTP_FROM")
+		if host == "" || from == "" {
+			return nil, ErrInvalidNotifierConfig
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = DEFAULT_SMTP_PORT
+		}
+		return &SMTPNotifier{
+			addr:     net.JoinHostPort(host, port),
+			host:     host,
+			from:     from,
+			username: os.Getenv("SMTP_USERNAME"),
+			password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	}
+	return nil, ErrInvalidNotifierConfig
+}
+
+// LogNotifier writes messages to the server log
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, msg Message) error {
+	log.Printf("Message to %s: %s\n%s\n", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileNotifier appends messages to a file, one after the other
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (fn *FileNotifier) Notify(ctx context.Context, msg Message) error {
+	fn.mu.Lock()
+	defer fn.mu.Unlock()
+
+	f, err := os.OpenFile(fn.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// SMTPNotifier sends messages as plain text emails, with PLAIN auth when SMTP_USERNAME is set.
+// net/smtp upgrades to TLS with STARTTLS when the server offers it
+type SMTPNotifier struct {
+	addr     string
+	host     string
+	from     string
+	username string
+	password string
+}
+
+func (sn *SMTPNotifier) Notify(ctx context.Context, msg Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return ErrNoRecipient
+	}
+
+	var auth smtp.Auth
+	if sn.username != "" {
+		auth = smtp.PlainAuth("", sn.username, sn.password, sn.host)
+	}
+
+	// header values must not contain line breaks, they would let a value add headers of its own
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(msg.Subject)
+	body := "From: " + sn.from + "\r\n" +
+		"To: " + to.String() + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(msg.Body, "\n", "\r\n")
+	return smtp.SendMail(sn.addr, auth, sn.from, []string{to.Address}, []byte(body))
+}
+
+// MemoryNotifier keeps messages instead of sending them, for tests
+type MemoryNotifier struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryNotifier() *MemoryNotifier {
+	return &MemoryNotifier{}
+}
+
+func (mn *MemoryNotifier) Notify(ctx context.Context, msg Message) error {
+	mn.mu.Lock()
+	defer mn.mu.Unlock()
+	mn.messages = append(mn.messages, msg)
+	return nil
+}
+
+// Messages returns the messages so far, oldest first
+func (mn *MemoryNotifier) Messages() []Message {
+	mn.mu.Lock()
+	defer mn.mu.Unlock()
+	return append([]Message(nil), mn.messages...)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// list endpoints are paginated with keysets: instead of an OFFSET the next page starts right after
+// the sort values of the last row of the previous page, which next_cursor carries
+
+// Page is the envelope of every paginated listing, NextCursor is null on the last page
+type Page[T any] struct {
+	Items      []T     `json:"items"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// PageParams are the pagination query params shared by list endpoints
+type PageParams struct {
+	Limit  int    // 1..MAX_PAGE_LIMIT, 0 means DEFAULT_PAGE_LIMIT
+	Cursor string // next_cursor of the previous page, empty for the first page
+	Sort   string // one of the orderings of the listing, empty means by id
+	Order  string // ORDER_ASC or ORDER_DESC flips the leading sort column, empty keeps its default
+}
+
+// sortKey is one column of a keyset ordering
+type sortKey[T any] struct {
+	expr  string         // SQL expression, must never be NULL so rows can be compared against the cursor
+	cast  string         // SQL type the cursor value is cast to
+	desc  bool           // default direction
+	value func(T) string // the value of expr for a row, as postgres parses it back
+}
+
+// pageCursor is what next_cursor encodes, Sort and Order pin the cursor to the ordering it came from
+type pageCursor struct {
+	Sort   string   `json:"s"`
+	Order  string   `json:"o"`
+	Values []string `json:"v"`
+}
+
+func encodeCursor(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// validatePageParams fills in the default limit and checks limit and order, sorts are checked by each service
+func validatePageParams(params *PageParams) error {
+	if params.Limit == 0 {
+		params.Limit = DEFAULT_PAGE_LIMIT
+	}
+	if params.Limit < 1 || params.Limit > MAX_PAGE_LIMIT {
+		return ErrInvalidLimit
+	}
+	switch params.Order {
+	case "", ORDER_ASC, ORDER_DESC:
+		return nil
+	}
+	return ErrInvalidOrder
+}
+
+// resolveSort returns the keys of the requested ordering, the last key must be the id tie-breaker.
+// An explicit order flips the leading key when it differs from its default and the id follows it
+func resolveSort[T any](sorts map[string][]sortKey[T], sort string, order string) ([]sortKey[T], bool) {
+	defaults, ok := sorts[sort]
+	if !ok {
+		return nil, false
+	}
+
+	keys := make([]sortKey[T], len(defaults))
+	copy(keys, defaults)
+	if order != "" && (order == ORDER_DESC) != keys[0].desc {
+		keys[0].desc = !keys[0].desc
+		if len(keys) > 1 {
+			keys[len(keys)-1].desc = !keys[len(keys)-1].desc
+		}
+	}
+	return keys, true
+}
+
+func orderByClause[T any](keys []sortKey[T]) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key.expr + " ASC"
+		if key.desc {
+			parts[i] = key.expr + " DESC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// keysetPredicate selects the rows that come after the cursor values, it is expanded into ORs so
+// that every key can have its own direction: (a > $1) OR (a = $1 AND b < $2) OR (a = $1 AND b = $2 AND id > $3)
+func keysetPredicate[T any](keys []sortKey[T], values []string, args []any) (string, []any) {
+	placeholders := make([]string, len(keys))
+	for i, key := range keys {
+		args = append(args, values[i])
+		placeholders[i] = "$" + strconv.Itoa(len(args)) + "::" + key.cast
+	}
+
+	alternatives := make([]string, len(keys))
+	for i, key := range keys {
+		conds := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			conds = append(conds, keys[j].expr+" = "+placeholders[j])
+		}
+		op := " > "
+		if key.desc {
+			op = " < "
+		}
+		conds = append(conds, key.expr+op+placeholders[i])
+		alternatives[i] = "(" + strings.Join(conds, " AND ") + ")"
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// applyCursor appends the keyset condition of params.Cursor to the where clause
+func applyCursor[T any](where []string, args []any, keys []sortKey[T], params PageParams) ([]string, []any, error) {
+	if params.Cursor == "" {
+		return where, args, nil
+	}
+
+	c, err := decodeCursor(params.Cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Sort != params.Sort || c.Order != params.Order || len(c.Values) != len(keys) {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	predicate, args := keysetPredicate(keys, c.Values, args)
+	return append(where, predicate), args, nil
+}
+
+// cursorError reports a query error caused by cursor values that don't cast to their columns as ErrInvalidCursor
+func cursorError(err error, params PageParams) error {
+	if params.Cursor != "" && IsDataException(err) {
+		return ErrInvalidCursor
+	}
+	return err
+}
+
+// newPage cuts the extra row a query fetched past the limit off and turns the last row into next_cursor
+func newPage[T any](items []T, keys []sortKey[T], params PageParams) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	if len(items) <= params.Limit {
+		return Page[T]{Items: items}
+	}
+
+	items = items[:params.Limit]
+	last := items[len(items)-1]
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = key.value(last)
+	}
+
+	next := encodeCursor(pageCursor{Sort: params.Sort, Order: params.Order, Values: values})
+	return Page[T]{Items: items, NextCursor: &next}
+}
+
+func formatCursorTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// pageParamsFromQuery reads ?limit, ?cursor, ?sort and ?order
+func pageParamsFromQuery(r *http.Request) (PageParams, error) {
+	query := r.URL.Query()
+	params := PageParams{
+		Cursor: query.Get("cursor"),
+		Sort:   query.Get("sort"),
+		Order:  strings.ToLower(query.Get("order")),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		l, err := ConvertToInt(limit)
+		if err != nil {
+			return PageParams{}, ErrInvalidLimit
+		}
+		params.Limit = l
+	}
+
+	return params, nil
+}
+
+// timeFromQuery reads an optional RFC 3339 timestamp query param
+func timeFromQuery(r *http.Request, key string) (*time.Time, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, ErrInvalidTimeFilter
+	}
+	return &t, nil
+}
+
+// listErrorStatus tells bad listing params apart from failures of the listing itself
+func listErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidCursor),
+		errors.Is(err, ErrInvalidLimit),
+		errors.Is(err, ErrInvalidOrder),
+		errors.Is(err, ErrInvalidSort),
+		errors.Is(err, ErrInvalidUserSort),
+		errors.Is(err, ErrInvalidSearchSort),
+		errors.Is(err, ErrInvalidAuditSort),
+		errors.Is(err, ErrEmptySearchQuery):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
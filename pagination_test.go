@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []pageCursor{
+		{Values: []string{"42"}},
+		{Sort: SORT_DUE, Order: ORDER_DESC, Values: []string{"2026-01-31T09:00:00Z", "7"}},
+		{Sort: SORT_TITLE, Values: []string{"buy \"milk\", eggs & bread", "3"}},
+	}
+
+	for _, want := range tests {
+		got, err := decodeCursor(encodeCursor(want))
+		if err != nil {
+			t.Errorf("decodeCursor(encodeCursor(%+v)) error = %v", want, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("decodeCursor(encodeCursor(%+v)) = %+v", want, got)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24", encodeCursor(pageCursor{})[:3] + "=="} {
+		if _, err := decodeCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor(%q) error = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
+
+func TestPageParams(t *testing.T) {
+	tests := []struct {
+		query string
+		want  PageParams
+		err   error
+	}{
+		{"", PageParams{Limit: DEFAULT_PAGE_LIMIT}, nil},
+		{"?limit=5&cursor=abc&sort=due&order=DESC", PageParams{Limit: 5, Cursor: "abc", Sort: "due", Order: ORDER_DESC}, nil},
+		{"?limit=abc", PageParams{}, ErrInvalidLimit},
+		{"?limit=-1", PageParams{}, ErrInvalidLimit},
+		{"?limit=100000", PageParams{}, ErrInvalidLimit},
+		{"?order=sideways", PageParams{}, ErrInvalidOrder},
+	}
+
+	for _, tt := range tests {
+		params, err := pageParamsFromQuery(httptest.NewRequest("GET", "/tasks"+tt.query, nil))
+		if err == nil {
+			err = validatePageParams(&params)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%q: error = %v, want %v", tt.query, err, tt.err)
+			continue
+		}
+		if err == nil && params != tt.want {
+			t.Errorf("%q: params = %+v, want %+v", tt.query, params, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// passwords are hashed with argon2id by default and stored in the PHC string format,
+// $argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<hash>, so every hash carries its own
+// parameters. Hashes made with other parameters or with bcrypt keep working and are replaced the
+// next time their user logs in, see UserService.AuthenticateUser
+
+type argon2Params struct {
+	memory      uint32 // KiB
+	iterations  uint32
+	parallelism uint8
+}
+
+// passwordHasher hashes with the configured algorithm and verifies argon2id and bcrypt hashes alike
+type passwordHasher struct {
+	algorithm  string
+	argon2     argon2Params
+	bcryptCost int
+}
+
+// NewPasswordHasherFromEnv reads PASSWORD_HASH (argon2id or bcrypt), ARGON2_MEMORY in KiB,
+// ARGON2_ITERATIONS, ARGON2_PARALLELISM and BCRYPT_COST
+func NewPasswordHasherFromEnv() (PasswordHasher, error) {
+	h := &passwordHasher{
+		algorithm: os.Getenv("PASSWORD_HASH"),
+		argon2: argon2Params{
+			memory:      DEFAULT_ARGON2_MEMORY,
+			iterations:  DEFAULT_ARGON2_ITERATIONS,
+			parallelism: DEFAULT_ARGON2_PARALLELISM,
+		},
+		bcryptCost: bcrypt.DefaultCost,
+	}
+	if h.algorithm == "" {
+		h.algorithm = PASSWORD_HASH_ARGON2ID
+	}
+	if h.algorithm != PASSWORD_HASH_ARGON2ID && h.algorithm != PASSWORD_HASH_BCRYPT {
+		return nil, ErrInvalidPasswordHashConfig
+	}
+
+	memory, ok := uintFromEnv("ARGON2_MEMORY", uint64(h.argon2.memory), 8, 4*1024*1024)
+	if !ok {
+		return nil, ErrInvalidPasswordHashConfig
+	}
+	iterations, ok := uintFromEnv("ARGON2_ITERATIONS", uint64(h.argon2.iterations), 1, 100)
+	if !ok {
+		return nil, ErrInvalidPasswordHashConfig
+	}
+	parallelism, ok := uintFromEnv("ARGON2_PARALLELISM", uint64(h.argon2.parallelism), 1, 255)
+	if !ok {
+		return nil, ErrInvalidPasswordHashConfig
+	}
+	cost, ok := uintFromEnv("BCRYPT_COST", uint64(h.bcryptCost), uint64(bcrypt.MinCost), uint64(bcrypt.MaxCost))
+	if !ok {
+		return nil, ErrInvalidPasswordHashConfig
+	}
+	h.argon2 = argon2Params{memory: uint32(memory), iterations: uint32(iterations), parallelism: uint8(parallelism)}
+	h.bcryptCost = int(cost)
+	return h, nil
+}
+
+// uintFromEnv reads a whole number between lo and hi from the env var key, def is used when it is not set
+func uintFromEnv(key string, def uint64, lo uint64, hi uint64) (uint64, bool) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, true
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || n < lo || n > hi {
+		return 0, false
+	}
+	return n, true
+}
+
+func (h *passwordHasher) Hash(password string) (string, error) {
+	if h.algorithm == PASSWORD_HASH_BCRYPT {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, ARGON2_SALT_LEN)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := h.argon2
+	key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, ARGON2_KEY_LEN)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches encoded, an argon2id or a bcrypt hash
+func (h *passwordHasher) Verify(encoded string, password string) (bool, error) {
+	if !strings.HasPrefix(encoded, "$argon2id$") {
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	p, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// NeedsRehash reports whether encoded was made with another algorithm or other parameters than Hash uses now
+func (h *passwordHasher) NeedsRehash(encoded string) bool {
+	if h.algorithm == PASSWORD_HASH_BCRYPT {
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != h.bcryptCost
+	}
+	p, _, key, err := decodeArgon2id(encoded)
+	return err != nil || p != h.argon2 || len(key) != ARGON2_KEY_LEN
+}
+
+// decodeArgon2id splits a PHC string into its parameters, salt and hash
+func decodeArgon2id(encoded string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	if p.iterations < 1 || p.parallelism < 1 {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	return p, salt, key, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testHasher is cheap enough for tests, the argon2id parameters still end up in every hash
+func testHasher(algorithm string) *passwordHasher {
+	return &passwordHasher{
+		algorithm:  algorithm,
+		argon2:     argon2Params{memory: 64, iterations: 1, parallelism: 1},
+		bcryptCost: bcrypt.MinCost,
+	}
+}
+
+func TestPasswordHasherArgon2id(t *testing.T) {
+	h := testHasher(PASSWORD_HASH_ARGON2ID)
+	encoded, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash = %q, want a PHC string with the parameters", encoded)
+	}
+
+	again, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == encoded {
+		t.Error("two hashes of the same password are equal, the salt is missing")
+	}
+
+	tests := []struct {
+		password string
+		match    bool
+	}{
+		{"correct horse", true},
+		{"Correct horse", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		match, err := h.Verify(encoded, tt.password)
+		if err != nil || match != tt.match {
+			t.Errorf("Verify(%q) = %v, %v, want %v", tt.password, match, err, tt.match)
+		}
+	}
+
+	if h.NeedsRehash(encoded) {
+		t.Error("NeedsRehash is true for a hash with the current parameters")
+	}
+	stronger := testHasher(PASSWORD_HASH_ARGON2ID)
+	stronger.argon2.iterations = 2
+	if !stronger.NeedsRehash(encoded) {
+		t.Error("NeedsRehash is false after the parameters changed")
+	}
+	if match, err := stronger.Verify(encoded, "correct horse"); err != nil || !match {
+		t.Errorf("a hash with old parameters no longer verifies: %v, %v", match, err)
+	}
+}
+
+func TestPasswordHasherBcryptFallback(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := testHasher(PASSWORD_HASH_ARGON2ID)
+	for password, want := range map[string]bool{"correct horse": true, "wrong": false} {
+		match, err := h.Verify(string(legacy), password)
+		if err != nil || match != want {
+			t.Errorf("Verify(bcrypt, %q) = %v, %v, want %v", password, match, err, want)
+		}
+	}
+	if !h.NeedsRehash(string(legacy)) {
+		t.Error("a bcrypt hash doesn't need a rehash with argon2id configured")
+	}
+
+	b := testHasher(PASSWORD_HASH_BCRYPT)
+	encoded, err := b.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.NeedsRehash(encoded) {
+		t.Error("NeedsRehash is true for a bcrypt hash with the current cost")
+	}
+	argon, _ := h.Hash("correct horse")
+	if !b.NeedsRehash(argon) {
+		t.Error("an argon2id hash doesn't need a rehash with bcrypt configured")
+	}
+}
+
+func TestDecodeArgon2idInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$not base64$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+	}
+
+	h := testHasher(PASSWORD_HASH_ARGON2ID)
+	for _, encoded := range tests {
+		if _, _, _, err := decodeArgon2id(encoded); !errors.Is(err, ErrInvalidPasswordHash) {
+			t.Errorf("decodeArgon2id(%q) error = %v, want ErrInvalidPasswordHash", encoded, err)
+		}
+		if strings.HasPrefix(encoded, "$argon2id$") {
+			if match, err := h.Verify(encoded, "x"); match || err == nil {
+				t.Errorf("Verify(%q) = %v, %v, want an error", encoded, match, err)
+			}
+		}
+	}
+}
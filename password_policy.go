@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy is checked for every new password: at sign-up, when an admin creates a user, on a
+// password change and on a reset. Passwords set before a stricter policy keep working
+type PasswordPolicy struct {
+	MinLength       int      `json:"min_length"` // in characters, not bytes
+	MaxLength       int      `json:"max_length"`
+	RequiredClasses []string `json:"required_classes"` // PASSWORD_CLASS_* values
+	BreachedCheck   bool     `json:"breached_check"`   // always on, the built-in list is checked without PASSWORD_BREACHED_FILE
+
+	breached *bloomFilter
+}
+
+// NewPasswordPolicyFromEnv reads PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH, PASSWORD_REQUIRED_CLASSES
+// (comma separated lower, upper, digit, symbol) and PASSWORD_BREACHED_FILE
+func NewPasswordPolicyFromEnv() (*PasswordPolicy, error) {
+	minLength, ok := uintFromEnv("PASSWORD_MIN_LENGTH", DEFAULT_PASSWORD_MIN_LENGTH, 1, MAX_PASSWORD_LENGTH)
+	if !ok {
+		return nil, ErrInvalidPasswordPolicyConfig
+	}
+	maxLength, ok := uintFromEnv("PASSWORD_MAX_LENGTH", DEFAULT_PASSWORD_MAX_LENGTH, minLength, MAX_PASSWORD_LENGTH)
+	if !ok {
+		return nil, ErrInvalidPasswordPolicyConfig
+	}
+
+	classes := []string{}
+	if value := os.Getenv("PASSWORD_REQUIRED_CLASSES"); value != "" {
+		for _, class := range strings.Split(value, ",") {
+			class = strings.TrimSpace(class)
+			if _, ok := passwordClasses[class]; !ok {
+				return nil, ErrInvalidPasswordPolicyConfig
+			}
+			classes = append(classes, class)
+		}
+	}
+
+	breached, err := loadBreachedPasswords(os.Getenv("PASSWORD_BREACHED_FILE"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasswordPolicy{
+		MinLength:       int(minLength),
+		MaxLength:       int(maxLength),
+		RequiredClasses: classes,
+		BreachedCheck:   true,
+		breached:        breached,
+	}, nil
+}
+
+// passwordClasses are the character classes a policy can require, with how the error names them
+var passwordClasses = map[string]struct {
+	name  string
+	match func(r rune) bool
+}{
+	PASSWORD_CLASS_LOWER:  {"a lowercase letter", unicode.IsLower},
+	PASSWORD_CLASS_UPPER:  {"an uppercase letter", unicode.IsUpper},
+	PASSWORD_CLASS_DIGIT:  {"a digit", unicode.IsDigit},
+	PASSWORD_CLASS_SYMBOL: {"a symbol", func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }},
+}
+
+// Validate checks a new password of the user called name, the error wraps ErrWeakPassword and says what to fix
+func (p *PasswordPolicy) Validate(password string, name string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("%w: use at least %d characters", ErrWeakPassword, p.MinLength)
+	}
+	if length > p.MaxLength {
+		return fmt.Errorf("%w: use at most %d characters", ErrWeakPassword, p.MaxLength)
+	}
+
+	var missing []string
+	for _, class := range p.RequiredClasses {
+		if !strings.ContainsFunc(password, passwordClasses[class].match) {
+			missing = append(missing, passwordClasses[class].name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: add %s", ErrWeakPassword, strings.Join(missing, ", "))
+	}
+
+	lowerName := strings.ToLower(strings.TrimSpace(name))
+	lowerPassword := strings.ToLower(password)
+	if lowerName != "" && (lowerPassword == lowerName || len(lowerName) >= 3 && strings.Contains(lowerPassword, lowerName)) {
+		return fmt.Errorf("%w: it must not contain the username", ErrWeakPassword)
+	}
+
+	if p.breached != nil && p.breached.contains(sha1.Sum([]byte(password))) {
+		return fmt.Errorf("%w: it is on a list of breached passwords, choose another one", ErrWeakPassword)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	breachedFile := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(breachedFile, []byte("Leaked-Pass-2026\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PASSWORD_MIN_LENGTH", "10")
+	t.Setenv("PASSWORD_MAX_LENGTH", "20")
+	t.Setenv("PASSWORD_REQUIRED_CLASSES", "lower,upper,digit")
+	t.Setenv("PASSWORD_BREACHED_FILE", breachedFile)
+
+	policy, err := NewPasswordPolicyFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		user     string
+		problem  string // part of the error message, empty when the password is fine
+	}{
+		{"fine", "Correct9Horse", "alice", ""},
+		{"length counts characters", "Äöüßéèêë9x", "alice", ""},
+		{"too short", "Short9x", "alice", "at least 10"},
+		{"too long", "Much9TooLongForThePolicy", "alice", "at most 20"},
+		{"missing classes", "alllowercase", "alice", "an uppercase letter, a digit"},
+		{"contains the name", "Alice2026xyz", "alice", "username"},
+		{"short names may appear", "Bob9Builder", "bo", ""},
+		{"breached", "Leaked-Pass-2026", "alice", "breached"},
+	}
+
+	for _, tt := range tests {
+		err := policy.Validate(tt.password, tt.user)
+		if tt.problem == "" {
+			if err != nil {
+				t.Errorf("%s: Validate(%q) error = %v", tt.name, tt.password, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrWeakPassword) || !strings.Contains(err.Error(), tt.problem) {
+			t.Errorf("%s: Validate(%q) error = %v, want ErrWeakPassword about %q", tt.name, tt.password, err, tt.problem)
+		}
+	}
+}
+
+func TestPasswordPolicyFromEnvInvalid(t *testing.T) {
+	tests := []map[string]string{
+		{"PASSWORD_MIN_LENGTH": "0"},
+		{"PASSWORD_MIN_LENGTH": "ten"},
+		{"PASSWORD_MIN_LENGTH": "12", "PASSWORD_MAX_LENGTH": "10"},
+		{"PASSWORD_MAX_LENGTH": "100000"},
+		{"PASSWORD_REQUIRED_CLASSES": "lower,emoji"},
+	}
+
+	for _, env := range tests {
+		t.Run("", func(t *testing.T) {
+			for key, value := range env {
+				t.Setenv(key, value)
+			}
+			if _, err := NewPasswordPolicyFromEnv(); !errors.Is(err, ErrInvalidPasswordPolicyConfig) {
+				t.Errorf("NewPasswordPolicyFromEnv with %v error = %v, want ErrInvalidPasswordPolicyConfig", env, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type PasswordResetPgRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPasswordResetPgRepository(pool *pgxpool.Pool) *PasswordResetPgRepository {
+	return &PasswordResetPgRepository{
+		pool: pool,
+	}
+}
+
+// Create stores a reset token in place of the user's earlier ones, so only the newest link works.
+// ErrPasswordResetTooSoon is returned when the user got a token after notBefore
+func (pr *PasswordResetPgRepository) Create(ctx context.Context, token PasswordResetToken, notBefore time.Time) error {
+	tx, err := pr.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// locks the user row so two requests at once can't both pass the check
+	_, err = tx.Exec(ctx, "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", token.UserId)
+	if err != nil {
+		return err
+	}
+
+	var recent bool
+	query := "SELECT EXISTS (SELECT 1 FROM password_reset_tokens WHERE user_id = $1 AND created_at > $2)"
+	if err := tx.QueryRow(ctx, query, token.UserId, notBefore).Scan(&recent); err != nil {
+		return err
+	}
+	if recent {
+		return ErrPasswordResetTooSoon
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM password_reset_tokens WHERE user_id = $1", token.UserId)
+	if err != nil {
+		return err
+	}
+
+	query = "INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)"
+	_, err = tx.Exec(ctx, query, token.UserId, token.TokenHash, token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetUserId returns the user of a live token without using it up
+func (pr *PasswordResetPgRepository) GetUserId(ctx context.Context, tokenHash string, now time.Time) (int, error) {
+	var userId int
+	query := "SELECT user_id FROM password_reset_tokens WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2"
+	err := pr.pool.QueryRow(ctx, query, tokenHash, now).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, err
+	}
+	return userId, nil
+}
+
+// Use marks a live token as used and returns its user, a token can only be used once
+func (pr *PasswordResetPgRepository) Use(ctx context.Context, tokenHash string, now time.Time) (int, error) {
+	var userId int
+	query := "UPDATE password_reset_tokens SET used_at = $1 WHERE token_hash = $2 AND used_at IS NULL AND expires_at > $1 RETURNING user_id"
+	err := pr.pool.QueryRow(ctx, query, now, tokenHash).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, err
+	}
+	return userId, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+)
+
+// PasswordResetService lets users who forgot their password set a new one with a token sent by the
+// notifier. Requests for unknown users look the same as the others, so they don't tell which exist
+type PasswordResetService struct {
+	userSvc  *UserService
+	repo     PasswordResetRepository
+	sessions RefreshTokenRepository
+	notifier Notifier
+	resetURL string // PASSWORD_RESET_URL, the page that takes the token, the message has the bare token without it
+}
+
+func NewPasswordResetService(userSvc *UserService, repo PasswordResetRepository, sessions RefreshTokenRepository, notifier Notifier, resetURL string) *PasswordResetService {
+	return &PasswordResetService{
+		userSvc:  userSvc,
+		repo:     repo,
+		sessions: sessions,
+		notifier: notifier,
+		resetURL: resetURL,
+	}
+}
+
+// RequestReset sends a reset token to the user, unknown names and repeated requests are ignored
+func (ps *PasswordResetService) RequestReset(ctx context.Context, name string) error {
+	user, err := ps.userSvc.GetUserByName(ctx, name)
+	if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrInvalidName) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = ps.repo.Create(ctx, PasswordResetToken{
+		UserId:    user.Id,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(PASSWORD_RESET_TTL),
+	}, now.Add(-PASSWORD_RESET_RESEND_DELAY))
+	if errors.Is(err, ErrPasswordResetTooSoon) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// sent in the background, waiting for the mail server would tell known names from unknown ones
+	msg := ps.resetMessage(user, token)
+	go func() {
+		if err := ps.notifier.Notify(context.WithoutCancel(ctx), msg); err != nil {
+			log.Println("Error sending password reset: ", err)
+		}
+	}()
+	return nil
+}
+
+// the link goes to the verified email, users without one get it at their name, which the SMTP
+// notifier can only reach if it is an email address
+func (ps *PasswordResetService) resetMessage(user *User, token string) Message {
+	link := token
+	if ps.resetURL != "" {
+		link = ps.resetURL + "?token=" + url.QueryEscape(token)
+	}
+	return Message{
+		To:      emailOrName(user),
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of %s. To choose a new one, use this within %d minutes:\n\n%s\n\n"+
+			"If it wasn't you, ignore this message, your password stays the same.", user.Name, int(PASSWORD_RESET_TTL.Minutes()), link),
+	}
+}
+
+// ResetPassword sets a new password with a reset token and ends every session of the user,
+// access tokens stop working because the password change bumps the token version
+func (ps *PasswordResetService) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	if token == "" {
+		return ErrInvalidResetToken
+	}
+
+	// the password is checked before the token is used up, so a rejected password can be fixed and sent again
+	userId, err := ps.repo.GetUserId(ctx, hashToken(token), time.Now())
+	if err != nil {
+		return err
+	}
+	user, err := ps.userSvc.GetUserById(ctx, userId, userId, USER)
+	if err != nil {
+		return err
+	}
+	if err := ps.userSvc.PasswordPolicy().Validate(newPassword, user.Name); err != nil {
+		return err
+	}
+
+	if _, err := ps.repo.Use(ctx, hashToken(token), time.Now()); err != nil {
+		return err
+	}
+	if err := ps.userSvc.SetPassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+	return ps.sessions.RevokeAllForUser(ctx, userId)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"time"
+)
+
+// personal access tokens are managed under /me/tokens, only with a logged in session: a token can't
+// create more tokens. The token itself is in the response of the create request and nowhere else
+
+func (s *Server) GetPersonalAccessTokensHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetId, ok := ctx.Value(targetIdContextKey).(int)
+	if !ok {
+		log.Println("Error getting target user id from context")
+		http.Error(w, "Unauthorized", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := s.patSvc.GetTokensByUserId(ctx, targetId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting personal access tokens: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, tokens)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) CreatePersonalAccessTokenHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetId, ok := ctx.Value(targetIdContextKey).(int)
+	if !ok {
+		log.Println("Error getting target user id from context")
+		http.Error(w, "Unauthorized", http.StatusInternalServerError)
+		return
+	}
+
+	var input struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	token, secret, err := s.patSvc.CreateToken(ctx, targetId, input.Name, input.Scopes, input.ExpiresAt, claims.MFA, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error creating personal access token: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusCreated)
+
+	response := struct {
+		*PersonalAccessToken
+		Token string `json:"token"`
+	}{token, secret}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) DeletePersonalAccessTokenHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error converting id to int: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.patSvc.DeleteToken(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error deleting personal access token: ", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrPersonalAccessTokenNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	response := map[string]any{
+		"id":     idInt,
+		"status": "Token revoked",
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
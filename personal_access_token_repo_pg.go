@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type PersonalAccessTokenPgRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPersonalAccessTokenPgRepository(pool *pgxpool.Pool) *PersonalAccessTokenPgRepository {
+	return &PersonalAccessTokenPgRepository{
+		pool: pool,
+	}
+}
+
+const personalAccessTokenColumns = "id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at"
+
+func scanPersonalAccessToken(row pgx.Row) (*PersonalAccessToken, error) {
+	var t PersonalAccessToken
+	err := row.Scan(&t.Id,
+		&t.UserId,
+		&t.Name,
+		&t.Prefix,
+		&t.Scopes,
+		&t.ExpiresAt,
+		&t.LastUsedAt,
+		&t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (pr *PersonalAccessTokenPgRepository) GetByUserId(ctx context.Context, userId int, actorId int, actorRole string) ([]PersonalAccessToken, error) {
+	query := "SELECT " + personalAccessTokenColumns + " FROM personal_access_tokens WHERE user_id = $1 AND (user_id = $2 OR " + permits("$3", PERM_USERS_READ) + ") ORDER BY id"
+	rows, err := pr.pool.Query(ctx, query, userId, actorId, actorRole)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []PersonalAccessToken{}
+	for rows.Next() {
+		token, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+func (pr *PersonalAccessTokenPgRepository) GetById(ctx context.Context, id int, actorId int, actorRole string) (*PersonalAccessToken, error) {
+	query := "SELECT " + personalAccessTokenColumns + " FROM personal_access_tokens WHERE id = $1 AND (user_id = $2 OR " + permits("$3", PERM_USERS_READ) + ")"
+	token, err := scanPersonalAccessToken(pr.pool.QueryRow(ctx, query, id, actorId, actorRole))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPersonalAccessTokenNotFound
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (pr *PersonalAccessTokenPgRepository) Create(ctx context.Context, token PersonalAccessToken) (int, error) {
+	var id int
+	query := `INSERT INTO personal_access_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at, mfa)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	err := pr.pool.QueryRow(ctx, query, token.UserId, token.Name, token.Prefix, token.TokenHash, token.Scopes, token.ExpiresAt, token.MFA).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (pr *PersonalAccessTokenPgRepository) Delete(ctx context.Context, id int, actorId int, actorRole string) error {
+	query := "DELETE FROM personal_access_tokens WHERE id = $1 AND (user_id = $2 OR " + permits("$3", PERM_USERS_UPDATE) + ")"
+	cmdTag, err := pr.pool.Exec(ctx, query, id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return ErrPersonalAccessTokenNotFound
+	}
+
+	return nil
+}
+
+// Authenticate looks up an unexpired token by its hash and returns it with the current role of its owner.
+// last_used_at is only written when it is older than PAT_LAST_USED_DELAY, not on every request
+func (pr *PersonalAccessTokenPgRepository) Authenticate(ctx context.Context, tokenHash string) (*PersonalAccessToken, string, error) {
+	now := time.Now()
+	query := `SELECT p.id, p.user_id, p.name, p.token_prefix, p.scopes, p.expires_at, p.last_used_at, p.created_at, p.mfa, u.role
+		FROM personal_access_tokens p JOIN users u ON u.id = p.user_id
+		WHERE p.token_hash = $1 AND p.expires_at > $2`
+
+	var t PersonalAccessToken
+	var role string
+	err := pr.pool.QueryRow(ctx, query, tokenHash, now).Scan(&t.Id,
+		&t.UserId,
+		&t.Name,
+		&t.Prefix,
+		&t.Scopes,
+		&t.ExpiresAt,
+		&t.LastUsedAt,
+		&t.CreatedAt,
+		&t.MFA,
+		&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", ErrInvalidPersonalAccessToken
+		}
+		return nil, "", err
+	}
+
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > PAT_LAST_USED_DELAY {
+		_, err = pr.pool.Exec(ctx, "UPDATE personal_access_tokens SET last_used_at = $1 WHERE id = $2", now, t.Id)
+		if err != nil {
+			return nil, "", err
+		}
+		t.LastUsedAt = &now
+	}
+
+	return &t, role, nil
+}
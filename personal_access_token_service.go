@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+)
+
+type PersonalAccessTokenService struct {
+	repo PersonalAccessTokenRepository
+}
+
+func NewPersonalAccessTokenService(repo PersonalAccessTokenRepository) *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{repo: repo}
+}
+
+// validateScopes checks every scope is a resource followed by :read or :write and drops duplicates
+func validateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+
+	valid := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		resource, access, ok := strings.Cut(strings.TrimSpace(scope), ":")
+		if !ok {
+			return nil, ErrInvalidScope
+		}
+		switch resource {
+		case SCOPE_TASKS, SCOPE_LABELS, SCOPE_PROJECTS, SCOPE_PROFILE, SCOPE_ADMIN:
+		default:
+			return nil, ErrInvalidScope
+		}
+		if access != SCOPE_READ && access != SCOPE_WRITE {
+			return nil, ErrInvalidScope
+		}
+		if !slices.Contains(valid, resource+":"+access) {
+			valid = append(valid, resource+":"+access)
+		}
+	}
+	return valid, nil
+}
+
+func (ps *PersonalAccessTokenService) GetTokensByUserId(ctx context.Context, userId int, actorId int, actorRole string) ([]PersonalAccessToken, error) {
+	if userId < 1 {
+		return nil, ErrIdMustBeGtZero
+	}
+	return ps.repo.GetByUserId(ctx, userId, actorId, actorRole)
+}
+
+// CreateToken stores a new token and returns it along with the token itself, which can't be recovered later.
+// A nil expiresAt means DEFAULT_PAT_TTL from now, mfa tells whether the creating session passed the second factor
+func (ps *PersonalAccessTokenService) CreateToken(ctx context.Context, userId int, name string, scopes []string, expiresAt *time.Time, mfa bool, actorId int, actorRole string) (*PersonalAccessToken, string, error) {
+	if userId < 1 {
+		return nil, "", ErrIdMustBeGtZero
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrEmptyPersonalAccessTokenName
+	}
+	if len([]rune(name)) > MAX_PAT_NAME_LEN {
+		return nil, "", ErrPersonalAccessTokenNameTooLong
+	}
+
+	scopes, err := validateScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	expires := now.Add(DEFAULT_PAT_TTL)
+	if expiresAt != nil {
+		expires = *expiresAt
+	}
+	if !expires.After(now) || expires.After(now.Add(MAX_PAT_TTL)) {
+		return nil, "", ErrInvalidTokenExpiry
+	}
+
+	random, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	secret := PAT_PREFIX + random
+
+	id, err := ps.repo.Create(ctx, PersonalAccessToken{
+		UserId:    userId,
+		Name:      name,
+		Prefix:    secret[:len(PAT_PREFIX)+4],
+		TokenHash: hashToken(secret),
+		Scopes:    scopes,
+		ExpiresAt: expires,
+		MFA:       mfa,
+	})
+	if err != nil {
+		if IsUniqueViolation(err) {
+			return nil, "", ErrPersonalAccessTokenNameTaken
+		}
+		return nil, "", err
+	}
+
+	token, err := ps.repo.GetById(ctx, id, actorId, actorRole)
+	if err != nil {
+		return nil, "", err
+	}
+	return token, secret, nil
+}
+
+func (ps *PersonalAccessTokenService) DeleteToken(ctx context.Context, id int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+	return ps.repo.Delete(ctx, id, actorId, actorRole)
+}
+
+// Authenticate turns a tdl_pat_ bearer token into claims, the role is the owner's current one
+func (ps *PersonalAccessTokenService) Authenticate(ctx context.Context, secret string) (*Claims, error) {
+	token, role, err := ps.repo.Authenticate(ctx, hashToken(secret))
+	if err != nil {
+		return nil, err
+	}
+	return &Claims{UserID: token.UserId, Role: role, MFA: token.MFA, TokenId: token.Id, Scopes: token.Scopes}, nil
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+// projects group the tasks of a single user, they live under /me/projects
+
+func (s *Server) GetProjectsByUserIdHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetId, ok := ctx.Value(targetIdContextKey).(int)
+	if !ok {
+		log.Println("Error getting target user id from context")
+		http.Error(w, "Unauthorized", http.StatusInternalServerError)
+		return
+	}
+
+	// archived projects are hidden unless ?archived=true
+	withArchived := r.URL.Query().Get("archived") == "true"
+
+	projects, err := s.projectSvc.GetProjectsByUserId(ctx, targetId, withArchived, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting projects: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, projects)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) CreateNewProjectHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetId, ok := ctx.Value(targetIdContextKey).(int)
+	if !ok {
+		log.Println("Error getting target user id from context")
+		http.Error(w, "Unauthorized", http.StatusInternalServerError)
+		return
+	}
+
+	var project Project
+
+	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	projectId, err := s.projectSvc.CreateNewProject(ctx, targetId, project.Name, project.Color)
+	if err != nil {
+		log.Println("Error creating new project: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	projectGotten, err := s.projectSvc.GetProjectById(ctx, projectId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting project by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusCreated)
+
+	err = EncodeJSONhelper(w, projectGotten)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) GetProjectByIdHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	project, err := s.projectSvc.GetProjectById(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting project by id: ", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, project)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetProjectTasksHTTP lists the tasks of a project, it accepts the same query params as GetTaskByUserIdHTTP
+func (s *Server) GetProjectTasksHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	project, err := s.projectSvc.GetProjectById(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting project by id: ", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	filter, err := taskFilterFromQuery(r)
+	if err != nil {
+		log.Println("Error parsing task filter: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.ProjectId = &project.Id
+
+	tasks, err := s.taskSvc.GetTaskById(ctx, project.UserId, filter, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting project tasks: ", err)
+		http.Error(w, err.Error(), listErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, mapPage(tasks, newTaskResponse))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) RenameProjectHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	err = s.projectSvc.RenameProject(ctx, input.Name, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error renaming project: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeProject(w, r, idInt)
+}
+
+func (s *Server) UpdateProjectColorHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Color string `json:"color"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	err = s.projectSvc.UpdateProjectColor(ctx, input.Color, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error updating project color: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeProject(w, r, idInt)
+}
+
+func (s *Server) SwitchProjectArchivedHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.projectSvc.SwitchProjectArchived(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error switching project archived flag: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeProject(w, r, idInt)
+}
+
+// DeleteProjectHTTP deletes the project and moves its tasks into the trash, unless ?reassign_to=<project id>
+// moves them into another project first or ?reassign_to=none keeps them without a project
+func (s *Server) DeleteProjectHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var reassignTo *int
+	switch reassign := r.URL.Query().Get("reassign_to"); reassign {
+	case "":
+	case "none":
+		noProject := 0
+		reassignTo = &noProject
+	default:
+		targetId, err := ConvertToInt(reassign)
+		if err != nil || targetId < 1 {
+			log.Println("Error parsing reassign_to: ", reassign)
+			http.Error(w, ErrInvalidReassign.Error(), http.StatusBadRequest)
+			return
+		}
+		reassignTo = &targetId
+	}
+
+	err = s.projectSvc.DeleteProject(ctx, idInt, reassignTo, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error deleting project: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	response := map[string]any{
+		"id":     idInt,
+		"status": "Project successfully deleted",
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// writeProject responds with the current state of a project after it was changed
+func (s *Server) writeProject(w http.ResponseWriter, r *http.Request, id int) {
+	ctx := r.Context()
+	claims := ctx.Value(userContextKey).(*Claims)
+
+	project, err := s.projectSvc.GetProjectById(ctx, id, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting project by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, project)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
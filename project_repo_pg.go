@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type ProjectPgRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewProjectPgRepository(pool *pgxpool.Pool) *ProjectPgRepository {
+	return &ProjectPgRepository{
+		pool: pool,
+	}
+}
+
+func (pr *ProjectPgRepository) GetByUserId(ctx context.Context, userId int, withArchived bool, actorId int, actorRole string) ([]Project, error) {
+	query := "SELECT id, user_id, name, color, is_archived, created_at, updated_at FROM projects WHERE user_id = $1 AND (user_id = $2 OR " + permits("$3", PERM_TASKS_READ_ALL) + ") AND ($4 OR NOT is_archived) ORDER BY name, id"
+	rows, err := pr.pool.Query(ctx, query, userId, actorId, actorRole, withArchived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []Project
+	for rows.Next() {
+		var p Project
+		err := rows.Scan(&p.Id, &p.UserId, &p.Name, &p.Color, &p.IsArchived, &p.CreatedAt, &p.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if projects == nil || len(projects) == 0 {
+		return []Project{}, nil
+	}
+
+	return projects, nil
+}
+
+func (pr *ProjectPgRepository) GetById(ctx context.Context, id int, actorId int, actorRole string) (*Project, error) {
+	var p Project
+	query := "SELECT id, user_id, name, color, is_archived, created_at, updated_at FROM projects WHERE id = $1 AND (user_id = $2 OR " + permits("$3", PERM_TASKS_READ_ALL) + ")"
+	err := pr.pool.QueryRow(ctx, query, id, actorId, actorRole).Scan(&p.Id,
+		&p.UserId,
+		&p.Name,
+		&p.Color,
+		&p.IsArchived,
+		&p.CreatedAt,
+		&p.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (pr *ProjectPgRepository) Create(ctx context.Context, project Project) (int, error) {
+	var id int
+	err := pr.pool.QueryRow(ctx, "INSERT INTO projects (user_id, name, color) VALUES ($1, $2, $3) RETURNING id", project.UserId, project.Name, project.Color).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Delete removes the project, its tasks move into the trash unless reassignTo is set (either way
+// recorded in task_events): a project id moves them into that unarchived project of the same owner, 0 keeps them without a project.
+// Tasks left in the project lose it through ON DELETE SET NULL
+func (pr *ProjectPgRepository) Delete(ctx context.Context, id int, reassignTo *int, actorId int, actorRole string) error {
+	tx, err := pr.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var ownerId int
+	err = tx.QueryRow(ctx, "SELECT user_id FROM projects WHERE id = $1 AND (user_id = $2 OR "+permits("$3", PERM_TASKS_WRITE_ALL)+") FOR UPDATE", id, actorId, actorRole).Scan(&ownerId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrProjectNotFound
+		}
+		return err
+	}
+
+	if reassignTo != nil {
+		var target *int
+		if *reassignTo != 0 {
+			var targetArchived bool
+			err = tx.QueryRow(ctx, "SELECT is_archived FROM projects WHERE id = $1 AND user_id = $2", *reassignTo, ownerId).Scan(&targetArchived)
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					return ErrProjectNotFound
+				}
+				return err
+			}
+			if targetArchived {
+				return ErrReassignArchived
+			}
+			target = reassignTo
+		}
+
+		// the parameters are integers, they are cast to text for the event values
+		query := `WITH moved AS (
+			UPDATE tasks SET project_id = $1, updated_at = $2 WHERE project_id = $3 RETURNING id
+		)
+		INSERT INTO task_events (task_id, actor_id, actor_role, field, old_value, new_value, impersonator_id)
+		SELECT moved.id, $4, $5, 'project_id', $3::int::text, $1::int::text, $6 FROM moved`
+		_, err = tx.Exec(ctx, query, target, time.Now(), id, actorId, actorRole, eventImpersonator(ctx))
+		if err != nil {
+			return err
+		}
+	} else if err := trashProjectTasks(ctx, tx, id, actorId, actorRole); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM projects WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// trashProjectTasks moves the tasks of a project into the trash and records it like TaskRepository.Delete does
+func trashProjectTasks(ctx context.Context, tx pgx.Tx, projectId int, actorId int, actorRole string) error {
+	query := "UPDATE tasks SET deleted_at = $2, updated_at = $2 WHERE project_id = $1 AND deleted_at IS NULL RETURNING id, " + eventValue("deleted_at")
+	rows, err := tx.Query(ctx, query, projectId, time.Now())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// the events are recorded after reading all rows, the connection is busy until then
+	var trashed []TaskEvent
+	for rows.Next() {
+		var e TaskEvent
+		if err := rows.Scan(&e.TaskId, &e.NewValue); err != nil {
+			return err
+		}
+		trashed = append(trashed, e)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range trashed {
+		if err := recordTaskEvent(ctx, tx, e.TaskId, actorId, actorRole, "deleted_at", nil, e.NewValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pr *ProjectPgRepository) UpdateName(ctx context.Context, newName string, id int, actorId int, actorRole string) error {
+	query := "UPDATE projects SET name = $1, updated_at = $2 WHERE id = $3 AND (user_id = $4 OR " + permits("$5", PERM_TASKS_WRITE_ALL) + ")"
+	cmdTag, err := pr.pool.Exec(ctx, query, newName, time.Now(), id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return ErrProjectNotFound
+	}
+
+	return nil
+}
+
+func (pr *ProjectPgRepository) UpdateColor(ctx context.Context, newColor string, id int, actorId int, actorRole string) error {
+	query := "UPDATE projects SET color = $1, updated_at = $2 WHERE id = $3 AND (user_id = $4 OR " + permits("$5", PERM_TASKS_WRITE_ALL) + ")"
+	cmdTag, err := pr.pool.Exec(ctx, query, newColor, time.Now(), id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return ErrProjectNotFound
+	}
+
+	return nil
+}
+
+func (pr *ProjectPgRepository) SwitchArchived(ctx context.Context, id int, actorId int, actorRole string) error {
+	query := "UPDATE projects SET is_archived = NOT is_archived, updated_at = $1 WHERE id = $2 AND (user_id = $3 OR " + permits("$4", PERM_TASKS_WRITE_ALL) + ")"
+	cmdTag, err := pr.pool.Exec(ctx, query, time.Now(), id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return ErrProjectNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+type ProjectService struct {
+	repo ProjectRepository
+}
+
+func NewProjectService(repo ProjectRepository) *ProjectService {
+	return &ProjectService{repo: repo}
+}
+
+func (ps *ProjectService) GetProjectsByUserId(ctx context.Context, userId int, withArchived bool, actorId int, actorRole string) ([]Project, error) {
+	if userId < 1 {
+		return nil, ErrIdMustBeGtZero
+	}
+	return ps.repo.GetByUserId(ctx, userId, withArchived, actorId, actorRole)
+}
+
+func (ps *ProjectService) GetProjectById(ctx context.Context, id int, actorId int, actorRole string) (*Project, error) {
+	if id < 1 {
+		return nil, ErrIdMustBeGtZero
+	}
+	return ps.repo.GetById(ctx, id, actorId, actorRole)
+}
+
+func (ps *ProjectService) CreateNewProject(ctx context.Context, userId int, name string, color string) (int, error) {
+	if userId < 1 {
+		return 0, ErrIdMustBeGtZero
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, ErrEmptyProjectName
+	}
+	if color == "" {
+		color = DEFAULT_COLOR
+	}
+	if !hexColorRegexp.MatchString(color) {
+		return 0, ErrInvalidColor
+	}
+
+	id, err := ps.repo.Create(ctx, Project{UserId: userId, Name: name, Color: strings.ToLower(color)})
+	if err != nil {
+		if IsForeignKeyViolation(err) {
+			return 0, ErrNoUserWithThisId
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+func (ps *ProjectService) RenameProject(ctx context.Context, newName string, id int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return ErrEmptyProjectName
+	}
+	return ps.repo.UpdateName(ctx, newName, id, actorId, actorRole)
+}
+
+func (ps *ProjectService) UpdateProjectColor(ctx context.Context, newColor string, id int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+	if !hexColorRegexp.MatchString(newColor) {
+		return ErrInvalidColor
+	}
+	return ps.repo.UpdateColor(ctx, strings.ToLower(newColor), id, actorId, actorRole)
+}
+
+func (ps *ProjectService) SwitchProjectArchived(ctx context.Context, id int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+	return ps.repo.SwitchArchived(ctx, id, actorId, actorRole)
+}
+
+// DeleteProject deletes the project and moves its tasks into the trash, see ProjectRepository.Delete for reassignTo
+func (ps *ProjectService) DeleteProject(ctx context.Context, id int, reassignTo *int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+	if reassignTo != nil && (*reassignTo < 0 || *reassignTo == id) {
+		return ErrInvalidReassign
+	}
+	return ps.repo.Delete(ctx, id, reassignTo, actorId, actorRole)
+}
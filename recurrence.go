@@ -0,0 +1,297 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence is the subset of RFC 5545 RRULE that recurring tasks support:
+// FREQ=DAILY|WEEKLY|MONTHLY|YEARLY with INTERVAL, BYDAY (weekly), BYMONTHDAY (monthly, or yearly together
+// with BYMONTH), BYMONTH (yearly), COUNT and UNTIL,
+// e.g. "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=12" or "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29"
+type Recurrence struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday // weekly only, empty means the weekday of the current occurrence
+	ByMonthDay int            // monthly or yearly, 1..31 or -1 for the last day, 0 means the day of the current occurrence
+	ByMonth    time.Month     // yearly only, 0 means the month of the current occurrence
+	Count      int            // occurrences left including the current one, 0 means unlimited
+	Until      *time.Time     // no occurrence after this moment
+}
+
+const (
+	FREQ_DAILY   = "DAILY"
+	FREQ_WEEKLY  = "WEEKLY"
+	FREQ_MONTHLY = "MONTHLY"
+	FREQ_YEARLY  = "YEARLY"
+)
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// ParseRecurrence parses an RRULE, the "RRULE:" prefix is optional and keys are case-insensitive
+func ParseRecurrence(rule string) (*Recurrence, error) {
+	rule = strings.TrimSpace(rule)
+	if len(rule) >= 6 && strings.EqualFold(rule[:6], "RRULE:") {
+		rule = rule[6:]
+	}
+	if rule == "" {
+		return nil, ErrInvalidRecurrence
+	}
+
+	rec := &Recurrence{Interval: 1}
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(rule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.ToUpper(strings.TrimSpace(key))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || value == "" || seen[key] {
+			return nil, ErrInvalidRecurrence
+		}
+		seen[key] = true
+
+		switch key {
+		case "FREQ":
+			switch value {
+			case FREQ_DAILY, FREQ_WEEKLY, FREQ_MONTHLY, FREQ_YEARLY:
+				rec.Freq = value
+			default:
+				return nil, ErrInvalidRecurrence
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 || interval > 1000 {
+				return nil, ErrInvalidRecurrence
+			}
+			rec.Interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := rruleWeekdays[day]
+				if !ok {
+					return nil, ErrInvalidRecurrence
+				}
+				rec.ByDay = append(rec.ByDay, weekday)
+			}
+		case "BYMONTHDAY":
+			day, err := strconv.Atoi(value)
+			if err != nil || day == 0 || day > 31 || day < -1 {
+				return nil, ErrInvalidRecurrence
+			}
+			rec.ByMonthDay = day
+		case "BYMONTH":
+			month, err := strconv.Atoi(value)
+			if err != nil || month < 1 || month > 12 {
+				return nil, ErrInvalidRecurrence
+			}
+			rec.ByMonth = time.Month(month)
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return nil, ErrInvalidRecurrence
+			}
+			rec.Count = count
+		case "UNTIL":
+			until, err := parseRRuleTime(value)
+			if err != nil {
+				return nil, ErrInvalidRecurrence
+			}
+			rec.Until = &until
+		default:
+			return nil, ErrInvalidRecurrence
+		}
+	}
+
+	if rec.Freq == "" {
+		return nil, ErrInvalidRecurrence
+	}
+	if len(rec.ByDay) > 0 && rec.Freq != FREQ_WEEKLY {
+		return nil, ErrInvalidRecurrence
+	}
+	if rec.ByMonth != 0 && rec.Freq != FREQ_YEARLY {
+		return nil, ErrInvalidRecurrence
+	}
+	// a yearly BYMONTHDAY without BYMONTH would mean that day in every month
+	if rec.ByMonthDay != 0 && rec.Freq != FREQ_MONTHLY && (rec.Freq != FREQ_YEARLY || rec.ByMonth == 0) {
+		return nil, ErrInvalidRecurrence
+	}
+	if rec.Count > 0 && rec.Until != nil {
+		// RFC 5545: COUNT and UNTIL MUST NOT occur in the same rule
+		return nil, ErrInvalidRecurrence
+	}
+
+	return rec, nil
+}
+
+// parseRRuleTime accepts the RFC 5545 forms 20260131, 20260131T090000 (read as UTC) and 20260131T090000Z
+func parseRRuleTime(value string) (time.Time, error) {
+	value = strings.TrimSuffix(value, "Z")
+	if len(value) == 8 {
+		// a date only UNTIL includes the whole day
+		t, err := time.Parse("20060102", value)
+		return t.Add(24*time.Hour - time.Second), err
+	}
+	return time.Parse("20060102T150405", value)
+}
+
+// String returns the rule in its canonical form, this is what gets stored in tasks.recurrence
+func (rec *Recurrence) String() string {
+	parts := []string{"FREQ=" + rec.Freq}
+	if rec.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(rec.Interval))
+	}
+	if len(rec.ByDay) > 0 {
+		days := make([]string, 0, len(rec.ByDay))
+		for _, weekday := range rec.ByDay {
+			for name, d := range rruleWeekdays {
+				if d == weekday {
+					days = append(days, name)
+				}
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if rec.ByMonth != 0 {
+		parts = append(parts, "BYMONTH="+strconv.Itoa(int(rec.ByMonth)))
+	}
+	if rec.ByMonthDay != 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(rec.ByMonthDay))
+	}
+	if rec.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(rec.Count))
+	}
+	if rec.Until != nil {
+		parts = append(parts, "UNTIL="+rec.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the occurrence following current and the rule the next occurrence carries
+// (COUNT goes down by one), ok is false when the series is over.
+// The next rule is pinned to the day (and for yearly rules the month) of the series anchor, so an
+// occurrence clamped to a shorter month (jan 31 -> feb 28) does not move the ones after it.
+// Monthly and yearly rules land on a later matching day of the current month or year before INTERVAL applies
+func (rec *Recurrence) Next(current time.Time) (next time.Time, nextRule *Recurrence, ok bool) {
+	if rec.Count == 1 {
+		return time.Time{}, nil, false
+	}
+
+	switch rec.Freq {
+	case FREQ_DAILY:
+		next = current.AddDate(0, 0, rec.Interval)
+	case FREQ_WEEKLY:
+		next = rec.nextWeekly(current)
+	case FREQ_MONTHLY:
+		next = dateInMonth(current, 0, 0, rec.anchorDay(current))
+		if !next.After(current) {
+			next = dateInMonth(current, 0, rec.Interval, rec.anchorDay(current))
+		}
+	case FREQ_YEARLY:
+		month := rec.ByMonth
+		if month == 0 {
+			month = current.Month()
+		}
+		next = dateInMonth(current, 0, int(month-current.Month()), rec.anchorDay(current))
+		if !next.After(current) {
+			next = dateInMonth(current, rec.Interval, int(month-current.Month()), rec.anchorDay(current))
+		}
+	}
+
+	if rec.Until != nil && next.After(*rec.Until) {
+		return time.Time{}, nil, false
+	}
+
+	nextRule = &Recurrence{}
+	*nextRule = *rec
+	if rec.Count > 0 {
+		nextRule.Count = rec.Count - 1
+	}
+	nextRule.pinAnchor(current)
+	return next, nextRule, true
+}
+
+// anchorDay is the day of the month monthly and yearly rules land on
+func (rec *Recurrence) anchorDay(current time.Time) int {
+	if rec.ByMonthDay != 0 {
+		return rec.ByMonthDay
+	}
+	return current.Day()
+}
+
+// pinAnchor fills in BYMONTHDAY (and BYMONTH for yearly rules) from the anchor occurrence,
+// daily and weekly rules are left as they are
+func (rec *Recurrence) pinAnchor(anchor time.Time) {
+	switch rec.Freq {
+	case FREQ_MONTHLY:
+		rec.ByMonthDay = rec.anchorDay(anchor)
+	case FREQ_YEARLY:
+		rec.ByMonthDay = rec.anchorDay(anchor)
+		if rec.ByMonth == 0 {
+			rec.ByMonth = anchor.Month()
+		}
+	}
+}
+
+// repin moves the anchor of a monthly or yearly rule to a new due date. BYMONTHDAY=-1 stays when
+// the new date is the last day of its month
+func (rec *Recurrence) repin(anchor time.Time) {
+	lastDay := rec.ByMonthDay == -1 && anchor.AddDate(0, 0, 1).Day() == 1
+	switch rec.Freq {
+	case FREQ_MONTHLY:
+		rec.ByMonthDay = 0
+	case FREQ_YEARLY:
+		rec.ByMonthDay = 0
+		rec.ByMonth = 0
+	}
+	if lastDay {
+		rec.ByMonthDay = -1
+	}
+	rec.pinAnchor(anchor)
+}
+
+// nextWeekly walks day by day to the next BYDAY weekday, only weeks that are INTERVAL weeks apart
+// from the current one count, weeks start on monday
+func (rec *Recurrence) nextWeekly(current time.Time) time.Time {
+	if len(rec.ByDay) == 0 {
+		return current.AddDate(0, 0, 7*rec.Interval)
+	}
+
+	weekStart := calendarDay(current) - (int(current.Weekday())+6)%7
+	for offset := 1; offset <= 7*rec.Interval+7; offset++ {
+		candidate := current.AddDate(0, 0, offset)
+		weeksApart := (calendarDay(candidate) - weekStart) / 7
+		if weeksApart%rec.Interval != 0 {
+			continue
+		}
+		for _, weekday := range rec.ByDay {
+			if candidate.Weekday() == weekday {
+				return candidate
+			}
+		}
+	}
+	return current.AddDate(0, 0, 7*rec.Interval)
+}
+
+// calendarDay numbers the days since the unix epoch, ignoring the time of day and DST shifts
+func calendarDay(t time.Time) int {
+	return int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+// dateInMonth moves t by the given years and months and puts it on day, which is clamped to the
+// length of the month (-1 is the last day), so a task due on the 31st is due on the 30th in april
+func dateInMonth(t time.Time, years int, months int, day int) time.Time {
+	firstOfMonth := time.Date(t.Year()+years, t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	if day == -1 || day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		rule      string
+		canonical string // empty when the rule is invalid
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"RRULE:freq=weekly;byday=mo,th;interval=2", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=12", "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=12"},
+		{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29"},
+		{"FREQ=DAILY;INTERVAL=1;UNTIL=20261231", "FREQ=DAILY;UNTIL=20261231T235959Z"},
+		{"FREQ=DAILY;UNTIL=20261231T090000Z", "FREQ=DAILY;UNTIL=20261231T090000Z"},
+		{"", ""},
+		{"RRULE:", ""},
+		{"FREQ=HOURLY", ""},
+		{"INTERVAL=2", ""},
+		{"FREQ=DAILY;FREQ=WEEKLY", ""},
+		{"FREQ=DAILY;INTERVAL=0", ""},
+		{"FREQ=DAILY;BYDAY=MO", ""},
+		{"FREQ=WEEKLY;BYDAY=XX", ""},
+		{"FREQ=MONTHLY;BYMONTHDAY=0", ""},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", ""},
+		{"FREQ=MONTHLY;BYMONTH=2", ""},
+		{"FREQ=YEARLY;BYMONTHDAY=29", ""},
+		{"FREQ=YEARLY;BYMONTH=13", ""},
+		{"FREQ=DAILY;COUNT=3;UNTIL=20261231", ""},
+		{"FREQ=DAILY;COUNT=0", ""},
+		{"FREQ=DAILY;WKST=MO", ""},
+	}
+
+	for _, tt := range tests {
+		rec, err := ParseRecurrence(tt.rule)
+		if tt.canonical == "" {
+			if !errors.Is(err, ErrInvalidRecurrence) {
+				t.Errorf("ParseRecurrence(%q) error = %v, want ErrInvalidRecurrence", tt.rule, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRecurrence(%q) error = %v", tt.rule, err)
+			continue
+		}
+		if got := rec.String(); got != tt.canonical {
+			t.Errorf("ParseRecurrence(%q).String() = %q, want %q", tt.rule, got, tt.canonical)
+		}
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		want  []time.Time // the occurrences after start, the series ends after the last one
+	}{
+		{"daily", "FREQ=DAILY;INTERVAL=2;COUNT=3", date(2026, 1, 30), []time.Time{date(2026, 2, 1), date(2026, 2, 3)}},
+		{"weekly on the weekday of start", "FREQ=WEEKLY;COUNT=3", date(2026, 1, 5), []time.Time{date(2026, 1, 12), date(2026, 1, 19)}},
+		{"weekly on two days", "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=4", date(2026, 1, 5), []time.Time{date(2026, 1, 8), date(2026, 1, 12), date(2026, 1, 15)}},
+		{"every other week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;COUNT=4", date(2026, 1, 9), []time.Time{date(2026, 1, 19), date(2026, 1, 23), date(2026, 2, 2)}},
+		{"monthly on the 31st", "FREQ=MONTHLY;COUNT=4", date(2026, 1, 31), []time.Time{date(2026, 2, 28), date(2026, 3, 31), date(2026, 4, 30)}},
+		{"monthly on the last day", "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3", date(2026, 1, 31), []time.Time{date(2026, 2, 28), date(2026, 3, 31)}},
+		{"monthly, later in the same month", "FREQ=MONTHLY;BYMONTHDAY=20;COUNT=3", date(2026, 1, 5), []time.Time{date(2026, 1, 20), date(2026, 2, 20)}},
+		{"every other month, later in the same month", "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=20;COUNT=3", date(2026, 1, 5), []time.Time{date(2026, 1, 20), date(2026, 3, 20)}},
+		{"yearly, later in the same year", "FREQ=YEARLY;BYMONTH=6;BYMONTHDAY=1;COUNT=3", date(2026, 1, 10), []time.Time{date(2026, 6, 1), date(2027, 6, 1)}},
+		{"every other year, later in the same year", "FREQ=YEARLY;INTERVAL=2;BYMONTH=6;BYMONTHDAY=1;COUNT=3", date(2026, 3, 1), []time.Time{date(2026, 6, 1), date(2028, 6, 1)}},
+		{"yearly on feb 29", "FREQ=YEARLY;COUNT=5", date(2024, 2, 29), []time.Time{date(2025, 2, 28), date(2026, 2, 28), date(2027, 2, 28), date(2028, 2, 29)}},
+		{"until", "FREQ=DAILY;UNTIL=20260103", date(2026, 1, 1), []time.Time{date(2026, 1, 2), date(2026, 1, 3)}},
+	}
+
+	for _, tt := range tests {
+		rec, err := ParseRecurrence(tt.rule)
+		if err != nil {
+			t.Fatalf("%s: ParseRecurrence(%q) error = %v", tt.name, tt.rule, err)
+		}
+
+		current := tt.start
+		for i, want := range tt.want {
+			next, nextRule, ok := rec.Next(current)
+			if !ok {
+				t.Fatalf("%s: occurrence %d: series ended early", tt.name, i+1)
+			}
+			if !next.Equal(want) {
+				t.Fatalf("%s: occurrence %d = %s, want %s", tt.name, i+1, next.Format(time.DateOnly), want.Format(time.DateOnly))
+			}
+
+			// the next occurrence is spawned from the stored rule, so it must survive a round trip
+			rec, err = ParseRecurrence(nextRule.String())
+			if err != nil {
+				t.Fatalf("%s: occurrence %d: ParseRecurrence(%q) error = %v", tt.name, i+1, nextRule.String(), err)
+			}
+			current = next
+		}
+
+		if next, _, ok := rec.Next(current); ok {
+			t.Errorf("%s: series goes on after the last occurrence with %s", tt.name, next.Format(time.DateOnly))
+		}
+	}
+}
+
+func TestRepinRecurrence(t *testing.T) {
+	date := func(year int, month time.Month, day int) *time.Time {
+		d := time.Date(year, month, day, 9, 0, 0, 0, time.UTC)
+		return &d
+	}
+
+	tests := []struct {
+		rule string
+		due  *time.Time
+		want string
+	}{
+		{"FREQ=MONTHLY;BYMONTHDAY=31", date(2026, 3, 15), "FREQ=MONTHLY;BYMONTHDAY=15"},
+		{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", date(2026, 7, 4), "FREQ=YEARLY;BYMONTH=7;BYMONTHDAY=4"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", date(2026, 4, 30), "FREQ=MONTHLY;BYMONTHDAY=-1"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", date(2026, 4, 29), "FREQ=MONTHLY;BYMONTHDAY=29"},
+		{"FREQ=WEEKLY;BYDAY=MO", date(2026, 4, 29), "FREQ=WEEKLY;BYDAY=MO"},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", nil, "FREQ=MONTHLY;BYMONTHDAY=31"},
+	}
+
+	for _, tt := range tests {
+		rule := tt.rule
+		got, err := repinRecurrence(&rule, tt.due)
+		if err != nil || got == nil || *got != tt.want {
+			t.Errorf("repinRecurrence(%q, %v) = %v, %v, want %q", tt.rule, tt.due, got, err, tt.want)
+		}
+	}
+}
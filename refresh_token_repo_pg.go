@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type RefreshTokenPgRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRefreshTokenPgRepository(pool *pgxpool.Pool) *RefreshTokenPgRepository {
+	return &RefreshTokenPgRepository{
+		pool: pool,
+	}
+}
+
+// Create stores a new refresh token and drops the expired ones of the same user
+func (rr *RefreshTokenPgRepository) Create(ctx context.Context, token RefreshToken) error {
+	tx, err := rr.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM refresh_tokens WHERE user_id = $1 AND expires_at < $2", token.UserId, time.Now())
+	if err != nil {
+		return err
+	}
+
+	query := "INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, mfa) VALUES ($1, $2, $3, $4, $5)"
+	_, err = tx.Exec(ctx, query, token.UserId, token.FamilyId, token.TokenHash, token.ExpiresAt, token.MFA)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Rotate marks the token with oldHash as used and stores next in its family, returning the old token.
+// A token that was already used is a replay: the whole family gets revoked and ErrRefreshTokenReused returned
+func (rr *RefreshTokenPgRepository) Rotate(ctx context.Context, oldHash string, next RefreshToken) (*RefreshToken, error) {
+	tx, err := rr.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var current RefreshToken
+	query := "SELECT id, user_id, family_id, expires_at, used_at, revoked_at, mfa FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE"
+	err = tx.QueryRow(ctx, query, oldHash).Scan(&current.Id,
+		&current.UserId,
+		&current.FamilyId,
+		&current.ExpiresAt,
+		&current.UsedAt,
+		&current.RevokedAt,
+		&current.MFA)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if current.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	now := time.Now()
+	if current.UsedAt != nil {
+		_, err = tx.Exec(ctx, "UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL", now, current.FamilyId)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if current.ExpiresAt.Before(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE refresh_tokens SET used_at = $1 WHERE id = $2", now, current.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	query = "INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, mfa) VALUES ($1, $2, $3, $4, $5)"
+	_, err = tx.Exec(ctx, query, current.UserId, current.FamilyId, next.TokenHash, next.ExpiresAt, current.MFA)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &current, nil
+}
+
+// RevokeFamily revokes the login session the token with tokenHash belongs to and returns its owner
+func (rr *RefreshTokenPgRepository) RevokeFamily(ctx context.Context, tokenHash string) (int, error) {
+	query := `UPDATE refresh_tokens SET revoked_at = $1
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $2) AND revoked_at IS NULL
+		RETURNING user_id`
+
+	var userId int
+	err := rr.pool.QueryRow(ctx, query, time.Now(), tokenHash).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidRefreshToken
+		}
+		return 0, err
+	}
+	return userId, nil
+}
+
+// RevokeAllForUser ends every login session of a user
+func (rr *RefreshTokenPgRepository) RevokeAllForUser(ctx context.Context, userId int) error {
+	_, err := rr.pool.Exec(ctx, "UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL", time.Now(), userId)
+	return err
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+// roles are managed under /admin/roles, what each role may do is the list of its permissions.
+// user and admin are built in, the others, like the seeded auditor and support, can be changed freely
+
+func roleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidRoleName), errors.Is(err, ErrInvalidPermission), errors.Is(err, ErrBuiltinRole):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrRoleTooPowerful):
+		return http.StatusForbidden
+	case errors.Is(err, ErrRoleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrRoleExists), errors.Is(err, ErrRoleInUse):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func (s *Server) GetRolesHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roles, err := s.roleSvc.GetRoles(ctx)
+	if err != nil {
+		log.Println("Error getting roles: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, roles)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) GetRoleHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	role, err := s.roleSvc.GetRole(ctx, chi.URLParam(r, "name"))
+	if err != nil {
+		log.Println("Error getting role: ", err)
+		http.Error(w, err.Error(), roleErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, role)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetPermissionsHTTP lists every permission a role can be given
+func (s *Server) GetPermissionsHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	permissions, err := s.roleSvc.GetPermissions(ctx)
+	if err != nil {
+		log.Println("Error getting permissions: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, permissions)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) CreateRoleHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	role := Role{Name: input.Name, Description: input.Description, Permissions: input.Permissions}
+	if err := s.roleSvc.CreateRole(ctx, role, claims.Role); err != nil {
+		log.Println("Error creating role: ", err)
+		http.Error(w, err.Error(), roleErrorStatus(err))
+		return
+	}
+
+	created, err := s.roleSvc.GetRole(ctx, input.Name)
+	if err != nil {
+		log.Println("Error getting role: ", err)
+		http.Error(w, err.Error(), roleErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusCreated)
+
+	err = EncodeJSONhelper(w, created)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ChangeRoleHTTP changes the description and the permissions present in the body, permissions replace the old ones
+func (s *Server) ChangeRoleHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Description *string   `json:"description"`
+		Permissions *[]string `json:"permissions"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var permissions []string
+	if input.Permissions != nil {
+		permissions = append([]string{}, *input.Permissions...)
+	}
+
+	name := chi.URLParam(r, "name")
+	if err := s.roleSvc.UpdateRole(ctx, name, input.Description, permissions, claims.Role); err != nil {
+		log.Println("Error updating role: ", err)
+		http.Error(w, err.Error(), roleErrorStatus(err))
+		return
+	}
+
+	s.GetRoleHTTP(w, r)
+}
+
+func (s *Server) DeleteRoleHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	if err := s.roleSvc.DeleteRole(ctx, name, claims.Role); err != nil {
+		log.Println("Error deleting role: ", err)
+		http.Error(w, err.Error(), roleErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	response := map[string]any{
+		"name":   name,
+		"status": "Role deleted",
+	}
+	err := EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type RolePgRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRolePgRepository(pool *pgxpool.Pool) *RolePgRepository {
+	return &RolePgRepository{
+		pool: pool,
+	}
+}
+
+// permits is the repository predicate that opens other users' rows to a role with permission.
+// role is the placeholder of the actor's role, like "$3", permission one of the PERM_* constants
+func permits(role string, permission string) string {
+	return "EXISTS (SELECT 1 FROM role_permissions WHERE role = " + role + " AND permission = '" + permission + "')"
+}
+
+// manages is true when the actor's role has every permission of the target's role, so a support
+// role can't take over an admin account. Both are placeholders or column names
+func manages(actorRole string, targetRole string) string {
+	return "NOT EXISTS (SELECT 1 FROM role_permissions tp WHERE tp.role = " + targetRole +
+		" AND NOT EXISTS (SELECT 1 FROM role_permissions ap WHERE ap.role = " + actorRole + " AND ap.permission = tp.permission))"
+}
+
+const roleColumns = `r.name, r.description, r.builtin, r.created_at, r.updated_at,
+	ARRAY(SELECT permission FROM role_permissions WHERE role = r.name ORDER BY permission)`
+
+func scanRole(row pgx.Row) (*Role, error) {
+	var role Role
+	err := row.Scan(&role.Name, &role.Description, &role.Builtin, &role.CreatedAt, &role.UpdatedAt, &role.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (rr *RolePgRepository) GetAll(ctx context.Context) ([]Role, error) {
+	rows, err := rr.pool.Query(ctx, "SELECT "+roleColumns+" FROM roles r ORDER BY r.builtin DESC, r.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, *role)
+	}
+	return roles, rows.Err()
+}
+
+func (rr *RolePgRepository) GetByName(ctx context.Context, name string) (*Role, error) {
+	role, err := scanRole(rr.pool.QueryRow(ctx, "SELECT "+roleColumns+" FROM roles r WHERE r.name = $1", name))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return role, nil
+}
+
+// GetPermissions returns the permissions of a role, none for a role that doesn't exist
+func (rr *RolePgRepository) GetPermissions(ctx context.Context, name string) ([]string, error) {
+	rows, err := rr.pool.Query(ctx, "SELECT permission FROM role_permissions WHERE role = $1 ORDER BY permission", name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+func (rr *RolePgRepository) GetAllPermissions(ctx context.Context) ([]Permission, error) {
+	rows, err := rr.pool.Query(ctx, "SELECT name, description FROM permissions ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []Permission{}
+	for rows.Next() {
+		var permission Permission
+		if err := rows.Scan(&permission.Name, &permission.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+func (rr *RolePgRepository) Create(ctx context.Context, role Role) error {
+	tx, err := rr.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "INSERT INTO roles (name, description) VALUES ($1, $2)", role.Name, role.Description)
+	if err != nil {
+		if IsUniqueViolation(err) {
+			return ErrRoleExists
+		}
+		return err
+	}
+	if err := insertRolePermissions(ctx, tx, role.Name, role.Permissions); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Update changes the description and replaces the permissions of a custom role, nil leaves them as they are
+func (rr *RolePgRepository) Update(ctx context.Context, name string, description *string, permissions []string) error {
+	tx, err := rr.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var builtin bool
+	err = tx.QueryRow(ctx, "SELECT builtin FROM roles WHERE name = $1 FOR UPDATE", name).Scan(&builtin)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRoleNotFound
+		}
+		return err
+	}
+	if builtin {
+		return ErrBuiltinRole
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE roles SET description = COALESCE($1, description), updated_at = $2 WHERE name = $3", description, time.Now(), name)
+	if err != nil {
+		return err
+	}
+	if permissions != nil {
+		if _, err := tx.Exec(ctx, "DELETE FROM role_permissions WHERE role = $1", name); err != nil {
+			return err
+		}
+		if err := insertRolePermissions(ctx, tx, name, permissions); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func insertRolePermissions(ctx context.Context, tx pgx.Tx, name string, permissions []string) error {
+	_, err := tx.Exec(ctx, "INSERT INTO role_permissions (role, permission) SELECT $1::text, unnest($2::text[])", name, permissions)
+	if err != nil {
+		if IsForeignKeyViolation(err) {
+			return ErrInvalidPermission
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes a custom role that no user has
+func (rr *RolePgRepository) Delete(ctx context.Context, name string) error {
+	cmdTag, err := rr.pool.Exec(ctx, "DELETE FROM roles WHERE name = $1 AND NOT builtin", name)
+	if err != nil {
+		if IsForeignKeyViolation(err) {
+			return ErrRoleInUse
+		}
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		if _, err := rr.GetByName(ctx, name); err != nil {
+			return err
+		}
+		return ErrBuiltinRole
+	}
+
+	return nil
+}
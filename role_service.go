@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// roleNamePattern matches the CHECK on roles.name
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// RoleService answers what a role may do. The permissions of every role are cached for ROLE_CACHE_TTL,
+// like app settings a change made by another instance shows up after that
+type RoleService struct {
+	repo RoleRepository
+
+	mu      sync.Mutex
+	entries map[string]roleEntry
+}
+
+type roleEntry struct {
+	permissions []string
+	expiresAt   time.Time
+}
+
+func NewRoleService(repo RoleRepository) *RoleService {
+	return &RoleService{repo: repo, entries: make(map[string]roleEntry)}
+}
+
+// Permissions returns the permissions of role, none for an unknown role
+func (rs *RoleService) Permissions(ctx context.Context, role string) ([]string, error) {
+	rs.mu.Lock()
+	entry, ok := rs.entries[role]
+	rs.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.permissions, nil
+	}
+
+	permissions, err := rs.repo.GetPermissions(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+
+	rs.mu.Lock()
+	rs.entries[role] = roleEntry{permissions: permissions, expiresAt: time.Now().Add(ROLE_CACHE_TTL)}
+	rs.mu.Unlock()
+	return permissions, nil
+}
+
+func (rs *RoleService) forget(role string) {
+	rs.mu.Lock()
+	delete(rs.entries, role)
+	rs.mu.Unlock()
+}
+
+func (rs *RoleService) HasPermission(ctx context.Context, role string, permission string) (bool, error) {
+	permissions, err := rs.Permissions(ctx, role)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(permissions, permission), nil
+}
+
+// IsStaff tells whether role has any permission, staff roles get into /admin and fall under require_admin_2fa
+func (rs *RoleService) IsStaff(ctx context.Context, role string) (bool, error) {
+	permissions, err := rs.Permissions(ctx, role)
+	if err != nil {
+		return false, err
+	}
+	return len(permissions) > 0, nil
+}
+
+// CanManage tells whether actorRole has every permission of targetRole, the Go side of the manages predicate
+func (rs *RoleService) CanManage(ctx context.Context, actorRole string, targetRole string) (bool, error) {
+	actor, err := rs.Permissions(ctx, actorRole)
+	if err != nil {
+		return false, err
+	}
+	target, err := rs.Permissions(ctx, targetRole)
+	if err != nil {
+		return false, err
+	}
+	return containsAll(actor, target), nil
+}
+
+func containsAll(have []string, want []string) bool {
+	for _, permission := range want {
+		if !slices.Contains(have, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+func (rs *RoleService) GetRoles(ctx context.Context) ([]Role, error) {
+	return rs.repo.GetAll(ctx)
+}
+
+func (rs *RoleService) GetRole(ctx context.Context, name string) (*Role, error) {
+	return rs.repo.GetByName(ctx, name)
+}
+
+func (rs *RoleService) GetPermissions(ctx context.Context) ([]Permission, error) {
+	return rs.repo.GetAllPermissions(ctx)
+}
+
+// normalizePermissions trims and deduplicates permissions, the actor can only hand out those they have
+func (rs *RoleService) normalizePermissions(ctx context.Context, permissions []string, actorRole string) ([]string, error) {
+	actor, err := rs.Permissions(ctx, actorRole)
+	if err != nil {
+		return nil, err
+	}
+	valid := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		permission = strings.TrimSpace(permission)
+		if permission == "" {
+			return nil, ErrInvalidPermission
+		}
+		if !slices.Contains(valid, permission) {
+			valid = append(valid, permission)
+		}
+	}
+	if !containsAll(actor, valid) {
+		return nil, ErrRoleTooPowerful
+	}
+	return valid, nil
+}
+
+func (rs *RoleService) CreateRole(ctx context.Context, role Role, actorRole string) error {
+	if !roleNamePattern.MatchString(role.Name) {
+		return ErrInvalidRoleName
+	}
+	permissions, err := rs.normalizePermissions(ctx, role.Permissions, actorRole)
+	if err != nil {
+		return err
+	}
+	role.Permissions = permissions
+	role.Description = strings.TrimSpace(role.Description)
+	if err := rs.repo.Create(ctx, role); err != nil {
+		return err
+	}
+	rs.forget(role.Name)
+	return nil
+}
+
+// UpdateRole changes a custom role, nil leaves the description or the permissions as they are.
+// The actor must have every permission the role has now and will have
+func (rs *RoleService) UpdateRole(ctx context.Context, name string, description *string, permissions []string, actorRole string) error {
+	if err := rs.checkManages(ctx, name, actorRole); err != nil {
+		return err
+	}
+	if permissions != nil {
+		valid, err := rs.normalizePermissions(ctx, permissions, actorRole)
+		if err != nil {
+			return err
+		}
+		permissions = valid
+	}
+	if description != nil {
+		trimmed := strings.TrimSpace(*description)
+		description = &trimmed
+	}
+	if err := rs.repo.Update(ctx, name, description, permissions); err != nil {
+		return err
+	}
+	rs.forget(name)
+	return nil
+}
+
+func (rs *RoleService) DeleteRole(ctx context.Context, name string, actorRole string) error {
+	if err := rs.checkManages(ctx, name, actorRole); err != nil {
+		return err
+	}
+	if err := rs.repo.Delete(ctx, name); err != nil {
+		return err
+	}
+	rs.forget(name)
+	return nil
+}
+
+func (rs *RoleService) checkManages(ctx context.Context, name string, actorRole string) error {
+	ok, err := rs.CanManage(ctx, actorRole, name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrRoleTooPowerful
+	}
+	return nil
+}
@@ -2,17 +2,35 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/cors"
 	"log"
+	"math"
 	"net/http"
+	"os"
+	"strconv"
 )
 
 type Server struct {
-	userSvc *UserService
-	taskSvc *TaskService
-	router  *chi.Mux
+	userSvc      *UserService
+	taskSvc      *TaskService
+	labelSvc     *LabelService
+	itemSvc      *TaskItemService
+	projectSvc   *ProjectService
+	authSvc      *AuthService
+	keys         *KeySet
+	patSvc       *PersonalAccessTokenService
+	twoFactorSvc *TwoFactorService
+	settingsSvc  *SettingsService
+	throttleSvc  *LoginThrottleService
+	resetSvc     *PasswordResetService
+	emailSvc     *EmailService
+	roleSvc      *RoleService
+	auditSvc     *AdminAuditService
+	trustProxy   bool // TRUST_PROXY=true, the server is behind a reverse proxy that sets X-Forwarded-For
+	router       *chi.Mux
 }
 
 type LoginRequest struct {
@@ -20,10 +38,6 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
-type LoginResponse struct {
-	Token string `json:"token"`
-}
-
 func (s *Server) LoginHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	var req LoginRequest
@@ -34,23 +48,26 @@ func (s *Server) LoginHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer r.Body.Close()
-	user, err := s.userSvc.AuthenticateUser(ctx, req.Name, req.Password)
+	tokens, err := s.authSvc.Login(ctx, req.Name, req.Password, clientIP(r, s.trustProxy))
 	if err != nil {
 		log.Println("Error authenticating user: ", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	token, err := GenerateJWT(user.Id, user.Role)
-	if err != nil {
-		log.Println("Error generating JWT: ", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		var throttled *ThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		case errors.Is(err, ErrInvalidCredentials):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case errors.Is(err, ErrInvalidName):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
-	response := LoginResponse{Token: token}
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	err = EncodeJSONhelper(w, response)
+	err = EncodeJSONhelper(w, tokens)
 	if err != nil {
 		log.Println("Error encoding JSON: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -58,21 +75,37 @@ func (s *Server) LoginHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func NewServer(userSvc *UserService, taskSvc *TaskService) *Server {
+func NewServer(userSvc *UserService, taskSvc *TaskService, labelSvc *LabelService, itemSvc *TaskItemService, projectSvc *ProjectService, authSvc *AuthService, keys *KeySet, patSvc *PersonalAccessTokenService, twoFactorSvc *TwoFactorService, settingsSvc *SettingsService, throttleSvc *LoginThrottleService, resetSvc *PasswordResetService, emailSvc *EmailService, roleSvc *RoleService, auditSvc *AdminAuditService) *Server {
 	s := &Server{
-		userSvc: userSvc,
-		taskSvc: taskSvc,
-		router:  chi.NewRouter(),
+		userSvc:      userSvc,
+		taskSvc:      taskSvc,
+		labelSvc:     labelSvc,
+		itemSvc:      itemSvc,
+		projectSvc:   projectSvc,
+		authSvc:      authSvc,
+		keys:         keys,
+		patSvc:       patSvc,
+		twoFactorSvc: twoFactorSvc,
+		settingsSvc:  settingsSvc,
+		throttleSvc:  throttleSvc,
+		resetSvc:     resetSvc,
+		emailSvc:     emailSvc,
+		roleSvc:      roleSvc,
+		auditSvc:     auditSvc,
+		trustProxy:   os.Getenv("TRUST_PROXY") == "true",
+		router:       chi.NewRouter(),
 	}
 
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
 		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders: []string{IMPERSONATION_HEADER}, // the frontend shows a banner while it is set
 		//AllowCredentials: true,
 		Debug: true,
 	})
 
+	s.router.Use(middleware.RequestID) // the audit log records it, a client can send its own as X-Request-Id
 	s.router.Use(middleware.Logger)
 	s.router.Use(middleware.Recoverer)
 	s.router.Use(middleware.StripSlashes)
@@ -88,36 +121,75 @@ func (s *Server) Routes() {
 	//s.router.Post("/setup-admin", s.CreateNewUserHTTP)
 	s.router.Post("/sign-up", s.CreateNewUserHTTP) // front completed
 	s.router.Post("/login", s.LoginHTTP)           // front completed
+	s.router.Post("/login/2fa", s.LoginTwoFactorHTTP)
+	s.router.Post("/token/refresh", s.RefreshTokenHTTP)
+	s.router.Post("/logout", s.LogoutHTTP)
+	s.router.Post("/password/forgot", s.ForgotPasswordHTTP)
+	s.router.Post("/password/reset", s.ResetPasswordHTTP)
+	s.router.Get("/password/policy", s.PasswordPolicyHTTP)
+	s.router.Post("/email/verify", s.VerifyEmailHTTP)
+	s.router.Get("/.well-known/jwks.json", s.JWKSHTTP)
 
 	s.router.Group(func(r chi.Router) {
-		r.Use(JWTmiddleware)
+		r.Use(s.JWTmiddleware)
+		r.Use(s.AuditImpersonation)
 		r.Route("/admin", func(r chi.Router) {
-			r.Use(AdminOnly)
-			// admin can see all users and do these actions with them
+			r.Use(s.StaffOnly)
+			r.Use(RequireScope(SCOPE_ADMIN))
+			// staff can see all users and do these actions with them, as far as their role's permissions go.
+			// Every write is recorded in the audit log, role changes by UpdateRoleHTTP itself
 			r.Route("/users", func(r chi.Router) { // 		// front completed
-				r.Get("/", s.GetAllUsersHTTP)    //			// front completed
-				r.Post("/", s.CreateNewUserHTTP) //			// front completed
+				r.With(s.RequirePermission(PERM_USERS_READ)).Get("/", s.GetAllUsersHTTP)                                                             // front completed
+				r.With(s.RequirePermission(PERM_USERS_CREATE), s.Audit(AUDIT_ACTION_USER_CREATE, s.auditedNewUser())).Post("/", s.CreateNewUserHTTP) // front completed
 
 				r.Route("/{id}", func(r chi.Router) { //
 					r.Use(s.InjectTargetID)
-					r.Get("/", s.GetUserByIdHTTP)                  // front completed
-					r.Patch("/rename", s.RenameUserHTTP)           // front completed
-					r.Patch("/password", s.ChangeUserPasswordHTTP) // front completed
-					r.Patch("/role", s.UpdateRoleHTTP)             // front completed
-					r.Delete("/", s.DeleteUserHTTP)                // front completed
-
-					r.Get("/tasks", s.GetTaskByUserIdHTTP) // получить таски данного пользователя // front completed
-					r.Post("/tasks", s.CreateNewTaskHTTP)  // создать таск данному пользователю   // front completed
+					r.With(s.RequirePermission(PERM_USERS_READ)).Get("/", s.GetUserByIdHTTP)                                                                          // front completed
+					r.With(s.RequirePermission(PERM_USERS_UPDATE), s.Audit(AUDIT_ACTION_USER_RENAME, s.auditedUser())).Patch("/rename", s.RenameUserHTTP)             // front completed
+					r.With(s.RequirePermission(PERM_USERS_UPDATE), s.Audit(AUDIT_ACTION_USER_PASSWORD, s.auditedUser())).Patch("/password", s.ChangeUserPasswordHTTP) // front completed
+					r.With(s.RequirePermission(PERM_ROLES_MANAGE)).Patch("/role", s.UpdateRoleHTTP)                                                                   // front completed
+					r.With(s.RequirePermission(PERM_USERS_UPDATE), s.Audit(AUDIT_ACTION_USER_EMAIL, s.auditedUser())).Patch("/email", s.ChangeEmailHTTP)
+					r.With(s.RequirePermission(PERM_USERS_UPDATE), s.Audit(AUDIT_ACTION_USER_2FA_RESET, s.auditedTwoFactor())).Delete("/2fa", s.ResetTwoFactorHTTP)
+					r.With(s.RequirePermission(PERM_USERS_DELETE), s.Audit(AUDIT_ACTION_USER_DELETE, s.auditedUser())).Delete("/", s.DeleteUserHTTP) // front completed
+					r.With(s.RequirePermission(PERM_USERS_IMPERSONATE), SessionOnly).Post("/impersonate", s.ImpersonateUserHTTP)
+
+					r.With(s.RequirePermission(PERM_TASKS_READ_ALL)).Get("/tasks", s.GetTaskByUserIdHTTP)                                                        // получить таски данного пользователя // front completed
+					r.With(s.RequirePermission(PERM_TASKS_WRITE_ALL), s.Audit(AUDIT_ACTION_TASK_CREATE, s.auditedNewTask())).Post("/tasks", s.CreateNewTaskHTTP) // создать таск данному пользователю   // front completed
 				})
 			})
-			// admin can see all tasks and do these actions with them, as well as with users
+			r.With(s.RequirePermission(PERM_LOCKOUTS_READ)).Get("/lockouts", s.GetLockoutsHTTP)
+			r.With(s.RequirePermission(PERM_LOCKOUTS_CLEAR), s.Audit(AUDIT_ACTION_LOCKOUT_CLEAR, s.auditedLockout())).Delete("/lockouts/{kind}/{key}", s.ClearLockoutHTTP)
+			r.With(s.RequirePermission(PERM_SETTINGS_READ)).Get("/settings", s.GetSettingsHTTP)
+			r.With(s.RequirePermission(PERM_SETTINGS_UPDATE), s.Audit(AUDIT_ACTION_SETTINGS_UPDATE, s.auditedSettings())).Patch("/settings", s.UpdateSettingsHTTP)
+			r.Route("/roles", func(r chi.Router) {
+				r.Use(s.RequireReadWritePermission(PERM_ROLES_READ, PERM_ROLES_MANAGE))
+				r.Get("/", s.GetRolesHTTP)
+				r.With(s.Audit(AUDIT_ACTION_ROLE_CREATE, s.auditedNewRole())).Post("/", s.CreateRoleHTTP)
+				r.Get("/{name}", s.GetRoleHTTP)
+				r.With(s.Audit(AUDIT_ACTION_ROLE_UPDATE, s.auditedRole())).Patch("/{name}", s.ChangeRoleHTTP)
+				r.With(s.Audit(AUDIT_ACTION_ROLE_DELETE, s.auditedRole())).Delete("/{name}", s.DeleteRoleHTTP)
+			})
+			r.With(s.RequirePermission(PERM_ROLES_READ)).Get("/permissions", s.GetPermissionsHTTP)
+			r.Route("/audit", func(r chi.Router) {
+				r.Use(s.RequirePermission(PERM_AUDIT_READ))
+				r.Get("/", s.GetAuditLogHTTP)
+				r.Get("/export", s.ExportAuditLogHTTP)
+			})
+			// staff can see all tasks and do these actions with them, as well as with users
 			r.Route("/tasks", func(r chi.Router) { // front completed
-				r.Get("/", s.GetAllTasksHTTP)         // front completed
+				r.Use(s.RequireReadWritePermission(PERM_TASKS_READ_ALL, PERM_TASKS_WRITE_ALL))
+				r.Get("/", s.GetAllTasksHTTP) // front completed
+				r.Get("/search", s.SearchTasksHTTP)
 				r.Route("/{id}", func(r chi.Router) { // front completed
-					r.Delete("/", s.DeleteTaskHTTP)                      // front completed
-					r.Patch("/title", s.UpdateTaskTitleHTTP)             // front completed
-					r.Patch("/description", s.UpdateTaskDescriptionHTTP) // front completed
-					r.Patch("/switch", s.SwitchTaskStatusHTTP)           // front completed
+					r.With(s.Audit(AUDIT_ACTION_TASK_DELETE, s.auditedTask())).Delete("/", s.DeleteTaskHTTP)                           // front completed
+					r.With(s.Audit(AUDIT_ACTION_TASK_TITLE, s.auditedTask())).Patch("/title", s.UpdateTaskTitleHTTP)                   // front completed
+					r.With(s.Audit(AUDIT_ACTION_TASK_DESCRIPTION, s.auditedTask())).Patch("/description", s.UpdateTaskDescriptionHTTP) // front completed
+					r.With(s.Audit(AUDIT_ACTION_TASK_STATUS, s.auditedTask())).Patch("/switch", s.SwitchTaskStatusHTTP)                // front completed
+					r.With(s.Audit(AUDIT_ACTION_TASK_PRIORITY, s.auditedTask())).Patch("/priority", s.UpdateTaskPriorityHTTP)
+					r.With(s.Audit(AUDIT_ACTION_TASK_DUE, s.auditedTask())).Patch("/due", s.UpdateTaskDueDateHTTP)
+					r.With(s.Audit(AUDIT_ACTION_TASK_RECURRENCE, s.auditedTask())).Patch("/recurrence", s.UpdateTaskRecurrenceHTTP)
+					r.Get("/history", s.GetTaskHistoryHTTP)
+					r.With(s.Audit(AUDIT_ACTION_TASK_ITEMS, s.auditedTaskItems())).Route("/items", s.TaskItemRoutes)
 				})
 			})
 		})
@@ -125,22 +197,84 @@ func (s *Server) Routes() {
 		r.Route("/me", func(r chi.Router) { //
 			r.Use(s.InjectTargetID)
 
-			r.Get("/", s.GetUserByIdHTTP)                  //  front completed
-			r.Patch("/rename", s.RenameUserHTTP)           //  front completed
-			r.Patch("/password", s.ChangeUserPasswordHTTP) //  front completed
-			r.Delete("/", s.DeleteUserHTTP)                //  front completed
+			r.With(RequireScope(SCOPE_PROFILE)).Get("/", s.GetUserByIdHTTP)        //  front completed
+			r.With(RequireScope(SCOPE_PROFILE)).Patch("/rename", s.RenameUserHTTP) //  front completed
+			r.With(SessionOnly).Patch("/password", s.ChangeUserPasswordHTTP)       //  front completed
+			r.With(SessionOnly).Delete("/", s.DeleteUserHTTP)                      //  front completed
+			r.With(SessionOnly).Patch("/email", s.ChangeEmailHTTP)
+			r.With(SessionOnly).Post("/email/verify", s.ResendEmailVerificationHTTP)
+
+			r.Route("/2fa", func(r chi.Router) {
+				r.Use(SessionOnly)
+				r.Get("/", s.GetTwoFactorStatusHTTP)
+				r.Post("/enroll", s.EnrollTwoFactorHTTP)
+				r.Post("/confirm", s.ConfirmTwoFactorHTTP)
+				r.Post("/recovery-codes", s.RegenerateRecoveryCodesHTTP)
+				r.Delete("/", s.DisableTwoFactorHTTP)
+			})
+
+			r.Route("/tokens", func(r chi.Router) {
+				r.Use(SessionOnly)
+				r.Get("/", s.GetPersonalAccessTokensHTTP)
+				r.Post("/", s.CreatePersonalAccessTokenHTTP)
+				r.Delete("/{id}", s.DeletePersonalAccessTokenHTTP)
+			})
 
 			r.Route("/tasks", func(r chi.Router) { // front completed
+				r.Use(RequireScope(SCOPE_TASKS))
 				r.Get("/", s.GetTaskByUserIdHTTP) // front completed
 				r.Post("/", s.CreateNewTaskHTTP)  // front completed
+				r.Get("/search", s.SearchTasksHTTP)
 
 				r.Route("/{id}", func(r chi.Router) { //
 					r.Delete("/", s.DeleteTaskHTTP)                      // front completed
 					r.Patch("/switch", s.SwitchTaskStatusHTTP)           // front completed
 					r.Patch("/title", s.UpdateTaskTitleHTTP)             // front completed
 					r.Patch("/description", s.UpdateTaskDescriptionHTTP) // front completed
+					r.Patch("/priority", s.UpdateTaskPriorityHTTP)
+					r.Patch("/due", s.UpdateTaskDueDateHTTP)
+					r.Patch("/recurrence", s.UpdateTaskRecurrenceHTTP)
+					r.Get("/history", s.GetTaskHistoryHTTP)
+					r.Post("/labels/{labelId}", s.AttachLabelHTTP)
+					r.Delete("/labels/{labelId}", s.DetachLabelHTTP)
+					r.Route("/items", s.TaskItemRoutes)
+				})
+			})
+
+			r.Route("/labels", func(r chi.Router) {
+				r.Use(RequireScope(SCOPE_LABELS))
+				r.Get("/", s.GetLabelsByUserIdHTTP)
+				r.Post("/", s.CreateNewLabelHTTP)
+
+				r.Route("/{id}", func(r chi.Router) {
+					r.Get("/", s.GetLabelByIdHTTP)
+					r.Patch("/rename", s.RenameLabelHTTP)
+					r.Patch("/color", s.UpdateLabelColorHTTP)
+					r.Delete("/", s.DeleteLabelHTTP)
 				})
 			})
+
+			r.Route("/projects", func(r chi.Router) {
+				r.Use(RequireScope(SCOPE_PROJECTS))
+				r.Get("/", s.GetProjectsByUserIdHTTP)
+				r.Post("/", s.CreateNewProjectHTTP)
+
+				r.Route("/{id}", func(r chi.Router) {
+					r.Get("/", s.GetProjectByIdHTTP)
+					r.With(RequireScope(SCOPE_TASKS)).Get("/tasks", s.GetProjectTasksHTTP)
+					r.Patch("/rename", s.RenameProjectHTTP)
+					r.Patch("/color", s.UpdateProjectColorHTTP)
+					r.Patch("/archive", s.SwitchProjectArchivedHTTP)
+					r.Delete("/", s.DeleteProjectHTTP)
+				})
+			})
+
+			r.Route("/trash", func(r chi.Router) {
+				r.Use(RequireScope(SCOPE_TASKS))
+				r.Get("/", s.GetTrashHTTP)
+				r.Post("/{id}/restore", s.RestoreTaskHTTP)
+				r.Delete("/{id}", s.DeleteTaskForeverHTTP)
+			})
 		})
 	})
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// app settings are changed by admins at runtime under /admin/settings
+
+type settingsResponse struct {
+	RequireAdmin2FA bool `json:"require_admin_2fa"`
+}
+
+func (s *Server) GetSettingsHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	required, err := s.settingsSvc.RequireAdminTwoFactor(ctx)
+	if err != nil {
+		log.Println("Error getting settings: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, settingsResponse{RequireAdmin2FA: required})
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdateSettingsHTTP changes the settings present in the body, the others are left alone
+func (s *Server) UpdateSettingsHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		RequireAdmin2FA *bool `json:"require_admin_2fa"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	if input.RequireAdmin2FA != nil {
+		err := s.settingsSvc.SetRequireAdminTwoFactor(ctx, *input.RequireAdmin2FA, claims.MFA)
+		if err != nil {
+			log.Println("Error updating settings: ", err)
+			http.Error(w, err.Error(), twoFactorErrorStatus(err))
+			return
+		}
+	}
+
+	s.GetSettingsHTTP(w, r)
+}
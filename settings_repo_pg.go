@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type SettingsPgRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewSettingsPgRepository(pool *pgxpool.Pool) *SettingsPgRepository {
+	return &SettingsPgRepository{
+		pool: pool,
+	}
+}
+
+// Get returns the value of an app setting, an empty string when it was never set
+func (sr *SettingsPgRepository) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := sr.pool.QueryRow(ctx, "SELECT value FROM app_settings WHERE key = $1", key).Scan(&value)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return value, nil
+}
+
+func (sr *SettingsPgRepository) Set(ctx context.Context, key string, value string) error {
+	query := `INSERT INTO app_settings (key, value, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = EXCLUDED.updated_at`
+	_, err := sr.pool.Exec(ctx, query, key, value, time.Now())
+	return err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SettingsService reads app settings through an in-memory cache, middlewares check them on every
+// request. Like token versions, a change made by another instance shows up after SETTINGS_CACHE_TTL
+type SettingsService struct {
+	repo SettingsRepository
+
+	mu      sync.Mutex
+	entries map[string]settingEntry
+}
+
+type settingEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func NewSettingsService(repo SettingsRepository) *SettingsService {
+	return &SettingsService{repo: repo, entries: make(map[string]settingEntry)}
+}
+
+func (ss *SettingsService) get(ctx context.Context, key string) (string, error) {
+	ss.mu.Lock()
+	entry, ok := ss.entries[key]
+	ss.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.value, nil
+	}
+
+	value, err := ss.repo.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	ss.mu.Lock()
+	ss.entries[key] = settingEntry{value: value, expiresAt: time.Now().Add(SETTINGS_CACHE_TTL)}
+	ss.mu.Unlock()
+	return value, nil
+}
+
+func (ss *SettingsService) set(ctx context.Context, key string, value string) error {
+	if err := ss.repo.Set(ctx, key, value); err != nil {
+		return err
+	}
+
+	ss.mu.Lock()
+	delete(ss.entries, key)
+	ss.mu.Unlock()
+	return nil
+}
+
+// RequireAdminTwoFactor tells whether admin sessions must have passed the second factor
+func (ss *SettingsService) RequireAdminTwoFactor(ctx context.Context) (bool, error) {
+	value, err := ss.get(ctx, SETTING_REQUIRE_ADMIN_2FA)
+	if err != nil {
+		return false, err
+	}
+	required, _ := strconv.ParseBool(value)
+	return required, nil
+}
+
+// SetRequireAdminTwoFactor can only be switched on from a session with 2FA, so the admin doing it isn't locked out
+func (ss *SettingsService) SetRequireAdminTwoFactor(ctx context.Context, required bool, actorMFA bool) error {
+	if required && !actorMFA {
+		return ErrTwoFactorRequired
+	}
+	return ss.set(ctx, SETTING_REQUIRE_ADMIN_2FA, strconv.FormatBool(required))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+)
+
+// task_events is the history of a task: every change is written in the same transaction as the change itself
+
+// eventValue renders a tasks column as event text, timestamps come out as RFC 3339 and NULL stays NULL
+func eventValue(column string) string {
+	return "to_jsonb(" + column + ") #>> '{}'"
+}
+
+func equalEventValues(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// eventImpersonator is the staff member behind the impersonation token of the request, nil for everyone
+// else. The actor of an event stays the impersonated user, their permissions are what allowed the change
+func eventImpersonator(ctx context.Context) *int {
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok || claims.Impersonator == nil {
+		return nil
+	}
+	return &claims.Impersonator.UserID
+}
+
+func recordTaskEvent(ctx context.Context, tx pgx.Tx, taskId int, actorId int, actorRole string, field string, oldValue *string, newValue *string) error {
+	query := "INSERT INTO task_events (task_id, actor_id, actor_role, field, old_value, new_value, impersonator_id) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	_, err := tx.Exec(ctx, query, taskId, actorId, actorRole, field, oldValue, newValue, eventImpersonator(ctx))
+	return err
+}
+
+// GetHistory returns the events of a task oldest first, tasks in the trash keep their history
+func (tr *TaskPgRepository) GetHistory(ctx context.Context, taskId int, actorId int, actorRole string) ([]TaskEvent, error) {
+	var taskExists bool
+	err := tr.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1 AND (user_id = $2 OR "+permits("$3", PERM_TASKS_READ_ALL)+"))", taskId, actorId, actorRole).Scan(&taskExists)
+	if err != nil {
+		return nil, err
+	}
+	if !taskExists {
+		return nil, ErrTaskNotFound
+	}
+
+	query := `SELECT e.id, e.task_id, e.actor_id, u.name, e.actor_role, e.impersonator_id, i.name, e.field, e.old_value, e.new_value, e.created_at
+		FROM task_events e LEFT JOIN users u ON u.id = e.actor_id LEFT JOIN users i ON i.id = e.impersonator_id
+		WHERE e.task_id = $1 ORDER BY e.id`
+	rows, err := tr.pool.Query(ctx, query, taskId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []TaskEvent
+	for rows.Next() {
+		var e TaskEvent
+		err := rows.Scan(&e.Id, &e.TaskId, &e.ActorId, &e.ActorName, &e.ActorRole, &e.ImpersonatorId, &e.ImpersonatorName, &e.Field, &e.OldValue, &e.NewValue, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if events == nil || len(events) == 0 {
+		return []TaskEvent{}, nil
+	}
+
+	return events, nil
+}
@@ -5,28 +5,95 @@ import (
 	"github.com/go-chi/chi/v5"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // this is all for tasks, in this case admin can view all tasks, change their status, etc.
 // in the users section you can also do the same
 // this is only for tasks, not for users and only for admins
 
+// taskFilterFromQuery reads the listing filters from the query string:
+// ?due=overdue|today|week, an optional ?tz=Europe/Berlin (UTC by default), ?completed=true|false,
+// ?created_after and ?updated_before (RFC 3339), ?labels=1,2 (tasks carrying any of these labels), ?project=3
+// and the page params ?limit, ?cursor, ?sort=id|priority|due|created|updated|title and ?order=asc|desc
+func taskFilterFromQuery(r *http.Request) (TaskFilter, error) {
+	query := r.URL.Query()
+
+	loc := time.UTC
+	if tz := query.Get("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return TaskFilter{}, ErrInvalidTimezone
+		}
+		loc = l
+	}
+
+	filter, err := DueFilter(query.Get("due"), loc, time.Now())
+	if err != nil {
+		return TaskFilter{}, err
+	}
+	filter.PageParams, err = pageParamsFromQuery(r)
+	if err != nil {
+		return TaskFilter{}, err
+	}
+
+	if completed := query.Get("completed"); completed != "" {
+		c, err := strconv.ParseBool(completed)
+		if err != nil {
+			return TaskFilter{}, ErrInvalidCompletedFilter
+		}
+		filter.Completed = &c
+	}
+
+	filter.CreatedAfter, err = timeFromQuery(r, "created_after")
+	if err != nil {
+		return TaskFilter{}, err
+	}
+	filter.UpdatedBefore, err = timeFromQuery(r, "updated_before")
+	if err != nil {
+		return TaskFilter{}, err
+	}
+
+	if labels := query.Get("labels"); labels != "" {
+		for _, l := range strings.Split(labels, ",") {
+			labelId, err := ConvertToInt(strings.TrimSpace(l))
+			if err != nil || labelId < 1 {
+				return TaskFilter{}, ErrInvalidLabelFilter
+			}
+			filter.LabelIds = append(filter.LabelIds, labelId)
+		}
+	}
+
+	if project := query.Get("project"); project != "" {
+		projectId, err := ConvertToInt(project)
+		if err != nil || projectId < 1 {
+			return TaskFilter{}, ErrInvalidProjectFilter
+		}
+		filter.ProjectId = &projectId
+	}
+
+	return filter, nil
+}
+
 func (s *Server) GetAllTasksHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	claims, ok := ctx.Value(userContextKey).(*Claims)
-	if !ok || claims.Role != ADMIN {
-		log.Printf("This is for admins only! Unsafe request for GetAllTasks: %s with id %d\n", claims.Role, claims.UserID)
-		http.Error(w, "This is for admins only!", http.StatusForbidden)
+	filter, err := taskFilterFromQuery(r)
+	if err != nil {
+		log.Println("Error parsing task filter: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	tasks, err := s.taskSvc.GetAllTasks(ctx)
+
+	tasks, err := s.taskSvc.GetAllTasks(ctx, filter)
 	if err != nil {
 		log.Println("Error getting all tasks: ", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), listErrorStatus(err))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	err = EncodeJSONhelper(w, tasks)
+	err = EncodeJSONhelper(w, mapPage(tasks, newTaskResponse))
 	if err != nil {
 		log.Println("Error encoding JSON: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -50,16 +117,23 @@ func (s *Server) GetTaskByUserIdHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task, err := s.taskSvc.GetTaskById(ctx, targetId, claims.UserID, claims.Role)
+	filter, err := taskFilterFromQuery(r)
+	if err != nil {
+		log.Println("Error parsing task filter: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	task, err := s.taskSvc.GetTaskById(ctx, targetId, filter, claims.UserID, claims.Role)
 
 	if err != nil {
 		log.Println("Error getting task by id: ", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), listErrorStatus(err))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
-	err = EncodeJSONhelper(w, task)
+	err = EncodeJSONhelper(w, mapPage(task, newTaskResponse))
 
 	if err != nil {
 		log.Println("Error encoding JSON: ", err)
@@ -67,6 +141,54 @@ func (s *Server) GetTaskByUserIdHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// SearchTasksHTTP searches the tasks of the target user under /me, under /admin it searches every task
+// unless ?user=<id> narrows it down. Takes ?q=, ?limit and ?cursor
+func (s *Server) SearchTasksHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// routes without InjectTargetID are the admin ones
+	targetId, ok := ctx.Value(targetIdContextKey).(int)
+	if !ok {
+		if user := r.URL.Query().Get("user"); user != "" {
+			userId, err := ConvertToInt(user)
+			if err != nil || userId < 1 {
+				log.Println("Error parsing user: ", user)
+				http.Error(w, ErrIdMustBeGtZero.Error(), http.StatusBadRequest)
+				return
+			}
+			targetId = userId
+		}
+	}
+
+	params, err := pageParamsFromQuery(r)
+	if err != nil {
+		log.Println("Error parsing page params: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, err := s.taskSvc.SearchTasks(ctx, r.URL.Query().Get("q"), targetId, params, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error searching tasks: ", err)
+		http.Error(w, err.Error(), listErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, mapPage(results, newTaskSearchResultResponse))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 func (s *Server) CreateNewTaskHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	claims, ok := ctx.Value(userContextKey).(*Claims)
@@ -89,14 +211,20 @@ func (s *Server) CreateNewTaskHTTP(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if claims.Role == ADMIN {
+		allowed, err := s.roleSvc.HasPermission(ctx, claims.Role, PERM_TASKS_WRITE_ALL)
+		if err != nil {
+			log.Println("Error getting role permissions: ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if allowed {
 			finalUserId = idInt
 		} else {
 			finalUserId = claims.UserID
 		}
 	}
 
-	var task Task
+	var task CreateTaskRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
 		log.Println("Error decoding JSON: ", err)
@@ -106,7 +234,7 @@ func (s *Server) CreateNewTaskHTTP(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
-	taskId, err := s.taskSvc.CreateNewTask(ctx, finalUserId, task.Title, task.Description)
+	taskId, err := s.taskSvc.CreateNewTask(ctx, finalUserId, task.ProjectId, task.Title, task.Description, task.DueDate, task.Priority, task.Recurrence, claims.UserID, claims.Role)
 	if err != nil {
 		log.Println("Error creating new task: ", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -123,7 +251,7 @@ func (s *Server) CreateNewTaskHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = EncodeJSONhelper(w, taskGotten)
+	err = EncodeJSONhelper(w, newTaskResponse(taskGotten))
 	if err != nil {
 		log.Println("Error encoding JSON: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -158,7 +286,7 @@ func (s *Server) DeleteTaskHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	response := map[string]any{
 		"id":     idInt,
-		"status": "Task successfully deleted",
+		"status": "Task moved to the trash",
 	}
 	err = EncodeJSONhelper(w, response)
 	if err != nil {
@@ -212,7 +340,7 @@ func (s *Server) UpdateTaskTitleHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	err = EncodeJSONhelper(w, task)
+	err = EncodeJSONhelper(w, newTaskResponse(task))
 	if err != nil {
 		log.Println("Error encoding JSON: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -267,7 +395,174 @@ func (s *Server) UpdateTaskDescriptionHTTP(w http.ResponseWriter, r *http.Reques
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	err = EncodeJSONhelper(w, task)
+	err = EncodeJSONhelper(w, newTaskResponse(task))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) UpdateTaskDueDateHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	idInt, err := ConvertToInt(id)
+
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// due_date is an RFC 3339 timestamp with an offset, null clears it
+	var taskDueDateForUpdate struct {
+		DueDate *time.Time `json:"due_date"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&taskDueDateForUpdate); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	err = s.taskSvc.UpdateDueDate(ctx, taskDueDateForUpdate.DueDate, idInt, claims.UserID, claims.Role)
+
+	if err != nil {
+		log.Println("Error updating task due date: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	task, err := s.taskSvc.GetTaskByItsId(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting task by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, newTaskResponse(task))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) UpdateTaskPriorityHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	idInt, err := ConvertToInt(id)
+
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var taskPriorityForUpdate struct {
+		Priority string `json:"priority"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&taskPriorityForUpdate); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	err = s.taskSvc.UpdatePriority(ctx, taskPriorityForUpdate.Priority, idInt, claims.UserID, claims.Role)
+
+	if err != nil {
+		log.Println("Error updating task priority: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	task, err := s.taskSvc.GetTaskByItsId(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting task by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, newTaskResponse(task))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdateTaskRecurrenceHTTP sets the RRULE of a task, {"recurrence": null} stops the task from recurring
+func (s *Server) UpdateTaskRecurrenceHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	idInt, err := ConvertToInt(id)
+
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var taskRecurrenceForUpdate struct {
+		Recurrence *string `json:"recurrence"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&taskRecurrenceForUpdate); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	err = s.taskSvc.UpdateRecurrence(ctx, taskRecurrenceForUpdate.Recurrence, idInt, claims.UserID, claims.Role)
+
+	if err != nil {
+		log.Println("Error updating task recurrence: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	task, err := s.taskSvc.GetTaskByItsId(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting task by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, newTaskResponse(task))
 	if err != nil {
 		log.Println("Error encoding JSON: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -310,7 +605,7 @@ func (s *Server) SwitchTaskStatusHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	err = EncodeJSONhelper(w, task)
+	err = EncodeJSONhelper(w, newTaskResponse(task))
 	if err != nil {
 		log.Println("Error encoding JSON: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -319,3 +614,39 @@ func (s *Server) SwitchTaskStatusHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // here we end the task http handlers for admins
+
+// GetTaskHistoryHTTP lists who changed what on a task, oldest first
+func (s *Server) GetTaskHistoryHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	idInt, err := ConvertToInt(id)
+
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, err := s.taskSvc.GetTaskHistory(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting task history: ", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, events)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+// checklist items of a task, mounted under /me/tasks/{id}/items and /admin/tasks/{id}/items
+
+func (s *Server) TaskItemRoutes(r chi.Router) {
+	r.Get("/", s.GetTaskItemsHTTP)
+	r.Post("/", s.CreateNewTaskItemHTTP)
+
+	r.Route("/{itemId}", func(r chi.Router) {
+		r.Delete("/", s.DeleteTaskItemHTTP)
+		r.Patch("/title", s.UpdateTaskItemTitleHTTP)
+		r.Patch("/switch", s.SwitchTaskItemStatusHTTP)
+		r.Patch("/position", s.MoveTaskItemHTTP)
+	})
+}
+
+// taskItemIdsFromURL reads the {id} of the task and the {itemId} of the checklist item
+func taskItemIdsFromURL(r *http.Request) (int, int, error) {
+	taskId, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		return 0, 0, err
+	}
+	itemId, err := ConvertToInt(chi.URLParam(r, "itemId"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return taskId, itemId, nil
+}
+
+func (s *Server) GetTaskItemsHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	taskId, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, err := s.itemSvc.GetItemsByTaskId(ctx, taskId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting checklist items: ", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, items)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) CreateNewTaskItemHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	taskId, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Title string `json:"title"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	itemId, err := s.itemSvc.CreateNewItem(ctx, taskId, input.Title, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error creating checklist item: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item, err := s.itemSvc.GetItemById(ctx, taskId, itemId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting checklist item by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusCreated)
+
+	err = EncodeJSONhelper(w, item)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) DeleteTaskItemHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	taskId, itemId, err := taskItemIdsFromURL(r)
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.itemSvc.DeleteItem(ctx, taskId, itemId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error deleting checklist item: ", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	response := map[string]any{
+		"id":     itemId,
+		"status": "Checklist item successfully deleted",
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) UpdateTaskItemTitleHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	taskId, itemId, err := taskItemIdsFromURL(r)
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Title string `json:"title"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	err = s.itemSvc.UpdateItemTitle(ctx, input.Title, taskId, itemId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error updating checklist item title: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeTaskItem(w, r, taskId, itemId)
+}
+
+func (s *Server) SwitchTaskItemStatusHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	taskId, itemId, err := taskItemIdsFromURL(r)
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.itemSvc.SwitchItemStatus(ctx, taskId, itemId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error switching checklist item status: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeTaskItem(w, r, taskId, itemId)
+}
+
+func (s *Server) MoveTaskItemHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	taskId, itemId, err := taskItemIdsFromURL(r)
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Position int `json:"position"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	err = s.itemSvc.MoveItem(ctx, input.Position, taskId, itemId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error moving checklist item: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.writeTaskItem(w, r, taskId, itemId)
+}
+
+// writeTaskItem responds with the current state of a checklist item after it was changed
+func (s *Server) writeTaskItem(w http.ResponseWriter, r *http.Request, taskId int, itemId int) {
+	ctx := r.Context()
+	claims := ctx.Value(userContextKey).(*Claims)
+
+	item, err := s.itemSvc.GetItemById(ctx, taskId, itemId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting checklist item by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, item)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
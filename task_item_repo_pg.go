@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// checklist items have no owner of their own, every query joins the parent task
+// and applies the same (user_id = actor OR the actor's role permits it) rule as TaskPgRepository
+
+type TaskItemPgRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewTaskItemPgRepository(pool *pgxpool.Pool) *TaskItemPgRepository {
+	return &TaskItemPgRepository{
+		pool: pool,
+	}
+}
+
+func (ir *TaskItemPgRepository) GetByTaskId(ctx context.Context, taskId int, actorId int, actorRole string) ([]TaskItem, error) {
+	var taskExists bool
+	err := ir.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1 AND (user_id = $2 OR "+permits("$3", PERM_TASKS_READ_ALL)+") AND deleted_at IS NULL)", taskId, actorId, actorRole).Scan(&taskExists)
+	if err != nil {
+		return nil, err
+	}
+	if !taskExists {
+		return nil, ErrTaskNotFound
+	}
+
+	rows, err := ir.pool.Query(ctx, "SELECT id, task_id, title, is_completed, position, created_at, updated_at FROM task_items WHERE task_id = $1 ORDER BY position, id", taskId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []TaskItem
+	for rows.Next() {
+		var i TaskItem
+		err := rows.Scan(&i.Id, &i.TaskId, &i.Title, &i.IsCompleted, &i.Position, &i.CreatedAt, &i.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if items == nil || len(items) == 0 {
+		return []TaskItem{}, nil
+	}
+
+	return items, nil
+}
+
+func (ir *TaskItemPgRepository) GetById(ctx context.Context, taskId int, itemId int, actorId int, actorRole string) (*TaskItem, error) {
+	query := "SELECT i.id, i.task_id, i.title, i.is_completed, i.position, i.created_at, i.updated_at FROM task_items i JOIN tasks t ON t.id = i.task_id WHERE i.id = $1 AND i.task_id = $2 AND (t.user_id = $3 OR " + permits("$4", PERM_TASKS_READ_ALL) + ") AND t.deleted_at IS NULL"
+
+	var i TaskItem
+	err := ir.pool.QueryRow(ctx, query, itemId, taskId, actorId, actorRole).Scan(&i.Id,
+		&i.TaskId,
+		&i.Title,
+		&i.IsCompleted,
+		&i.Position,
+		&i.CreatedAt,
+		&i.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTaskItemNotFound
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+// lockTask locks the parent task of a checklist, which serializes concurrent changes to its positions.
+// It returns pgx.ErrNoRows when the actor can't change the task
+func lockTask(ctx context.Context, tx pgx.Tx, taskId int, actorId int, actorRole string) error {
+	var taskExists bool
+	return tx.QueryRow(ctx, "SELECT TRUE FROM tasks WHERE id = $1 AND (user_id = $2 OR "+permits("$3", PERM_TASKS_WRITE_ALL)+") AND deleted_at IS NULL FOR UPDATE", taskId, actorId, actorRole).Scan(&taskExists)
+}
+
+// itemEventValue renders the checklist item of table (or alias) as the JSON of an EVENT_ITEM event
+func itemEventValue(table string) string {
+	return "jsonb_build_object('id', " + table + ".id, 'title', " + table + ".title, 'is_completed', " + table + ".is_completed, 'position', " + table + ".position)::text"
+}
+
+// Create appends the item to the end of the checklist
+func (ir *TaskItemPgRepository) Create(ctx context.Context, taskId int, title string, actorId int, actorRole string) (int, error) {
+	tx, err := ir.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockTask(ctx, tx, taskId, actorId, actorRole); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrTaskNotFound
+		}
+		return 0, err
+	}
+
+	var id int
+	var newValue *string
+	query := "INSERT INTO task_items (task_id, title, position) SELECT $1, $2, COALESCE(MAX(position) + 1, 0) FROM task_items WHERE task_id = $1 RETURNING id, " + itemEventValue("task_items")
+	if err := tx.QueryRow(ctx, query, taskId, title).Scan(&id, &newValue); err != nil {
+		return 0, err
+	}
+
+	if err := recordTaskEvent(ctx, tx, taskId, actorId, actorRole, EVENT_ITEM, nil, newValue); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit(ctx)
+}
+
+// Delete removes the item and closes the gap it leaves in the positions
+func (ir *TaskItemPgRepository) Delete(ctx context.Context, taskId int, itemId int, actorId int, actorRole string) error {
+	tx, err := ir.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockTask(ctx, tx, taskId, actorId, actorRole); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTaskItemNotFound
+		}
+		return err
+	}
+
+	var position int
+	var oldValue *string
+	query := "DELETE FROM task_items i USING tasks t WHERE i.task_id = t.id AND i.id = $1 AND i.task_id = $2 AND (t.user_id = $3 OR " + permits("$4", PERM_TASKS_WRITE_ALL) + ") AND t.deleted_at IS NULL RETURNING i.position, " + itemEventValue("i")
+	err = tx.QueryRow(ctx, query, itemId, taskId, actorId, actorRole).Scan(&position, &oldValue)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTaskItemNotFound
+		}
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE task_items SET position = position - 1 WHERE task_id = $1 AND position > $2", taskId, position)
+	if err != nil {
+		return err
+	}
+
+	if err := recordTaskEvent(ctx, tx, taskId, actorId, actorRole, EVENT_ITEM, oldValue, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (ir *TaskItemPgRepository) UpdateTitle(ctx context.Context, newTitle string, taskId int, itemId int, actorId int, actorRole string) error {
+	return ir.changeItem(ctx, taskId, itemId, actorId, actorRole, "title = $3, updated_at = $4", newTitle, time.Now())
+}
+
+func (ir *TaskItemPgRepository) SwitchStatus(ctx context.Context, taskId int, itemId int, actorId int, actorRole string) error {
+	return ir.changeItem(ctx, taskId, itemId, actorId, actorRole, "is_completed = NOT is_completed, updated_at = $3", time.Now())
+}
+
+// changeItem applies set to an item and records it as an EVENT_ITEM task event, in one transaction like
+// TaskPgRepository.changeTask. set refers to args from $3 on, a change that leaves the item as it was is not recorded
+func (ir *TaskItemPgRepository) changeItem(ctx context.Context, taskId int, itemId int, actorId int, actorRole string, set string, args ...any) error {
+	tx, err := ir.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockTask(ctx, tx, taskId, actorId, actorRole); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTaskItemNotFound
+		}
+		return err
+	}
+
+	var oldValue, newValue *string
+	err = tx.QueryRow(ctx, "SELECT "+itemEventValue("task_items")+" FROM task_items WHERE id = $1 AND task_id = $2", itemId, taskId).Scan(&oldValue)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTaskItemNotFound
+		}
+		return err
+	}
+
+	query := "UPDATE task_items SET " + set + " WHERE id = $1 AND task_id = $2 RETURNING " + itemEventValue("task_items")
+	err = tx.QueryRow(ctx, query, append([]any{itemId, taskId}, args...)...).Scan(&newValue)
+	if err != nil {
+		return err
+	}
+
+	if !equalEventValues(oldValue, newValue) {
+		if err := recordTaskEvent(ctx, tx, taskId, actorId, actorRole, EVENT_ITEM, oldValue, newValue); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Move puts the item at newPosition and shifts the items in between, positions past the end are clamped
+func (ir *TaskItemPgRepository) Move(ctx context.Context, newPosition int, taskId int, itemId int, actorId int, actorRole string) error {
+	tx, err := ir.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockTask(ctx, tx, taskId, actorId, actorRole); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTaskItemNotFound
+		}
+		return err
+	}
+
+	var oldPosition, count int
+	var oldValue, newValue *string
+	query := "SELECT position, (SELECT COUNT(*) FROM task_items WHERE task_id = $2), " + itemEventValue("task_items") + " FROM task_items WHERE id = $1 AND task_id = $2"
+	err = tx.QueryRow(ctx, query, itemId, taskId).Scan(&oldPosition, &count, &oldValue)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTaskItemNotFound
+		}
+		return err
+	}
+
+	if newPosition > count-1 {
+		newPosition = count - 1
+	}
+
+	if newPosition < oldPosition {
+		_, err = tx.Exec(ctx, "UPDATE task_items SET position = position + 1 WHERE task_id = $1 AND position >= $2 AND position < $3", taskId, newPosition, oldPosition)
+	} else if newPosition > oldPosition {
+		_, err = tx.Exec(ctx, "UPDATE task_items SET position = position - 1 WHERE task_id = $1 AND position > $2 AND position <= $3", taskId, oldPosition, newPosition)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(ctx, "UPDATE task_items SET position = $1, updated_at = $2 WHERE id = $3 RETURNING "+itemEventValue("task_items"), newPosition, time.Now(), itemId).Scan(&newValue)
+	if err != nil {
+		return err
+	}
+
+	if !equalEventValues(oldValue, newValue) {
+		if err := recordTaskEvent(ctx, tx, taskId, actorId, actorRole, EVENT_ITEM, oldValue, newValue); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
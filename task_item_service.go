@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+type TaskItemService struct {
+	repo TaskItemRepository
+}
+
+func NewTaskItemService(repo TaskItemRepository) *TaskItemService {
+	return &TaskItemService{repo: repo}
+}
+
+func (is *TaskItemService) GetItemsByTaskId(ctx context.Context, taskId int, actorId int, actorRole string) ([]TaskItem, error) {
+	if taskId < 1 {
+		return nil, ErrIdMustBeGtZero
+	}
+	return is.repo.GetByTaskId(ctx, taskId, actorId, actorRole)
+}
+
+func (is *TaskItemService) GetItemById(ctx context.Context, taskId int, itemId int, actorId int, actorRole string) (*TaskItem, error) {
+	if taskId < 1 || itemId < 1 {
+		return nil, ErrIdMustBeGtZero
+	}
+	return is.repo.GetById(ctx, taskId, itemId, actorId, actorRole)
+}
+
+func (is *TaskItemService) CreateNewItem(ctx context.Context, taskId int, title string, actorId int, actorRole string) (int, error) {
+	if taskId < 1 {
+		return 0, ErrIdMustBeGtZero
+	}
+	if strings.TrimSpace(title) == "" {
+		return 0, ErrEmptyTitle
+	}
+	return is.repo.Create(ctx, taskId, title, actorId, actorRole)
+}
+
+func (is *TaskItemService) DeleteItem(ctx context.Context, taskId int, itemId int, actorId int, actorRole string) error {
+	if taskId < 1 || itemId < 1 {
+		return ErrIdMustBeGtZero
+	}
+	return is.repo.Delete(ctx, taskId, itemId, actorId, actorRole)
+}
+
+func (is *TaskItemService) UpdateItemTitle(ctx context.Context, newTitle string, taskId int, itemId int, actorId int, actorRole string) error {
+	if taskId < 1 || itemId < 1 {
+		return ErrIdMustBeGtZero
+	}
+	if strings.TrimSpace(newTitle) == "" {
+		return ErrEmptyTitle
+	}
+	return is.repo.UpdateTitle(ctx, newTitle, taskId, itemId, actorId, actorRole)
+}
+
+func (is *TaskItemService) SwitchItemStatus(ctx context.Context, taskId int, itemId int, actorId int, actorRole string) error {
+	if taskId < 1 || itemId < 1 {
+		return ErrIdMustBeGtZero
+	}
+	return is.repo.SwitchStatus(ctx, taskId, itemId, actorId, actorRole)
+}
+
+func (is *TaskItemService) MoveItem(ctx context.Context, newPosition int, taskId int, itemId int, actorId int, actorRole string) error {
+	if taskId < 1 || itemId < 1 {
+		return ErrIdMustBeGtZero
+	}
+	if newPosition < 0 {
+		return ErrInvalidPosition
+	}
+	return is.repo.Move(ctx, newPosition, taskId, itemId, actorId, actorRole)
+}
@@ -3,10 +3,63 @@ package main
 import (
 	"context"
 	"errors"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"html"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// taskColumns is the column list every task query selects, keep it in sync with scanTask
+const taskColumns = "id, user_id, project_id, title, description, is_completed, due_date, priority, recurrence, created_at, updated_at, deleted_at, " +
+	"(SELECT COUNT(*) FROM task_items i WHERE i.task_id = tasks.id), " +
+	"(SELECT COUNT(*) FROM task_items i WHERE i.task_id = tasks.id AND i.is_completed)"
+
+var (
+	taskIdAsc  = sortKey[Task]{expr: "id", cast: "bigint", value: func(t Task) string { return strconv.Itoa(t.Id) }}
+	taskIdDesc = sortKey[Task]{expr: "id", cast: "bigint", desc: true, value: taskIdAsc.value}
+
+	taskPriorityKey = sortKey[Task]{expr: "priority", cast: "task_priority", desc: true, value: func(t Task) string { return t.Priority }}
+	// tasks without a due date sort as if they were due at the end of time
+	taskDueKey = sortKey[Task]{expr: "COALESCE(due_date, 'infinity')", cast: "timestamptz", value: func(t Task) string {
+		if t.DueDate == nil {
+			return "infinity"
+		}
+		return formatCursorTime(*t.DueDate)
+	}}
+)
+
+// taskSorts maps the SORT_* values to their keyset ordering, id is always the last tie-breaker
+var taskSorts = map[string][]sortKey[Task]{
+	"":            {taskIdAsc},
+	SORT_ID:       {taskIdAsc},
+	SORT_PRIORITY: {taskPriorityKey, taskDueKey, taskIdAsc},
+	SORT_DUE:      {taskDueKey, taskPriorityKey, taskIdAsc},
+	SORT_CREATED: {
+		{expr: "created_at", cast: "timestamptz", desc: true, value: func(t Task) string { return formatCursorTime(t.CreatedAt) }},
+		taskIdDesc,
+	},
+	SORT_UPDATED: {
+		{expr: "updated_at", cast: "timestamptz", desc: true, value: func(t Task) string { return formatCursorTime(t.UpdatedAt) }},
+		taskIdDesc,
+	},
+	SORT_TITLE: {
+		{expr: "title", cast: "text", value: func(t Task) string { return t.Title }},
+		taskIdAsc,
+	},
+	// only meaningful for the trash, where deleted_at is always set
+	SORT_DELETED: {
+		{expr: "COALESCE(deleted_at, '-infinity')", cast: "timestamptz", desc: true, value: func(t Task) string {
+			if t.DeletedAt == nil {
+				return "-infinity"
+			}
+			return formatCursorTime(*t.DeletedAt)
+		}},
+		taskIdDesc,
+	},
+}
+
 type TaskPgRepository struct {
 	pool *pgxpool.Pool
 }
@@ -17,164 +70,464 @@ func NewTaskPgRepository(pool *pgxpool.Pool) *TaskPgRepository {
 	}
 }
 
-func (tr *TaskPgRepository) GetAll(ctx context.Context) ([]Task, error) {
+// taskScanTargets are the scan destinations matching taskColumns
+func taskScanTargets(t *Task) []any {
+	return []any{&t.Id,
+		&t.UserId,
+		&t.ProjectId,
+		&t.Title,
+		&t.Description,
+		&t.IsCompleted,
+		&t.DueDate,
+		&t.Priority,
+		&t.Recurrence,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+		&t.DeletedAt,
+		&t.ItemsTotal,
+		&t.ItemsDone}
+}
+
+func scanTask(row pgx.Row) (Task, error) {
+	var t Task
+	err := row.Scan(taskScanTargets(&t)...)
+	return t, err
+}
+
+// applyTaskFilter appends the filter conditions to the where clause, new placeholders continue after args
+func applyTaskFilter(where []string, args []any, filter TaskFilter) ([]string, []any) {
+	if filter.DueFrom != nil {
+		args = append(args, *filter.DueFrom)
+		where = append(where, "due_date >= $"+strconv.Itoa(len(args)))
+	}
+	if filter.DueBefore != nil {
+		args = append(args, *filter.DueBefore)
+		where = append(where, "due_date < $"+strconv.Itoa(len(args)))
+	}
+	if filter.Trashed {
+		where = append(where, "deleted_at IS NOT NULL")
+	} else {
+		where = append(where, "deleted_at IS NULL")
+	}
+	if filter.OnlyOpen {
+		where = append(where, "NOT is_completed")
+	}
+	if filter.Completed != nil {
+		args = append(args, *filter.Completed)
+		where = append(where, "is_completed = $"+strconv.Itoa(len(args)))
+	}
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		where = append(where, "created_at > $"+strconv.Itoa(len(args)))
+	}
+	if filter.UpdatedBefore != nil {
+		args = append(args, *filter.UpdatedBefore)
+		where = append(where, "updated_at < $"+strconv.Itoa(len(args)))
+	}
+	if filter.ProjectId != nil {
+		args = append(args, *filter.ProjectId)
+		where = append(where, "project_id = $"+strconv.Itoa(len(args)))
+	}
+	if len(filter.LabelIds) > 0 {
+		args = append(args, filter.LabelIds)
+		where = append(where, "EXISTS (SELECT 1 FROM task_labels tl WHERE tl.task_id = tasks.id AND tl.label_id = ANY($"+strconv.Itoa(len(args))+"))")
+	}
+	return where, args
+}
+
+// loadLabels fills in the labels of every task with a single query
+func (tr *TaskPgRepository) loadLabels(ctx context.Context, tasks []Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(tasks))
+	byId := make(map[int]*Task, len(tasks))
+	for i := range tasks {
+		tasks[i].Labels = []Label{}
+		ids[i] = tasks[i].Id
+		byId[tasks[i].Id] = &tasks[i]
+	}
+
+	query := "SELECT tl.task_id, l.id, l.user_id, l.name, l.color, l.created_at, l.updated_at FROM task_labels tl JOIN labels l ON l.id = tl.label_id WHERE tl.task_id = ANY($1) ORDER BY l.name"
+	rows, err := tr.pool.Query(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var taskId int
+		var l Label
+		err := rows.Scan(&taskId, &l.Id, &l.UserId, &l.Name, &l.Color, &l.CreatedAt, &l.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		byId[taskId].Labels = append(byId[taskId].Labels, l)
+	}
+
+	return rows.Err()
+}
+
+// queryTasks returns one page of the tasks matching where, ordered by params.Sort
+func (tr *TaskPgRepository) queryTasks(ctx context.Context, where []string, args []any, params PageParams) (Page[Task], error) {
 	var tasks []Task
 
-	rows, err := tr.pool.Query(ctx, "SELECT id, user_id, title, description, is_completed, created_at, updated_at FROM tasks")
+	keys, ok := resolveSort(taskSorts, params.Sort, params.Order)
+	if !ok {
+		return Page[Task]{}, ErrInvalidSort
+	}
+
+	where, args, err := applyCursor(where, args, keys, params)
 	if err != nil {
-		return nil, err
+		return Page[Task]{}, err
+	}
+
+	query := "SELECT " + taskColumns + " FROM tasks"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// one row more than the limit tells whether there is a next page
+	args = append(args, params.Limit+1)
+	query += " ORDER BY " + orderByClause(keys) + " LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := tr.pool.Query(ctx, query, args...)
+	if err != nil {
+		return Page[Task]{}, cursorError(err, params)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var t Task
-		err := rows.Scan(&t.Id,
-			&t.UserId,
-			&t.Title,
-			&t.Description,
-			&t.IsCompleted,
-			&t.CreatedAt,
-			&t.UpdatedAt)
+		t, err := scanTask(rows)
 		if err != nil {
-			return nil, err
+			return Page[Task]{}, err
 		}
 		tasks = append(tasks, t)
 	}
 
-	if tasks == nil || len(tasks) == 0 {
-		return []Task{}, nil
+	if err := rows.Err(); err != nil {
+		return Page[Task]{}, cursorError(err, params)
 	}
 
-	return tasks, nil
+	page := newPage(tasks, keys, params)
+	if err := tr.loadLabels(ctx, page.Items); err != nil {
+		return Page[Task]{}, err
+	}
+
+	return page, nil
 }
 
-func (tr *TaskPgRepository) GetByUserId(ctx context.Context, id int, actorID int, actorRole string) ([]Task, error) {
-	var tasks []Task
-	query := "SELECT id, user_id, title, description, is_completed, created_at, updated_at FROM tasks WHERE user_id = $1 AND (user_id = $2 OR $3 = 'admin')"
-	row, err := tr.pool.Query(ctx, query, id, actorID, actorRole)
+func (tr *TaskPgRepository) GetAll(ctx context.Context, filter TaskFilter) (Page[Task], error) {
+	where, args := applyTaskFilter(nil, nil, filter)
+	return tr.queryTasks(ctx, where, args, filter.PageParams)
+}
+
+func (tr *TaskPgRepository) GetByUserId(ctx context.Context, id int, filter TaskFilter, actorID int, actorRole string) (Page[Task], error) {
+	where := []string{"user_id = $1 AND (user_id = $2 OR " + permits("$3", PERM_TASKS_READ_ALL) + ")"}
+	args := []any{id, actorID, actorRole}
+	where, args = applyTaskFilter(where, args, filter)
+	return tr.queryTasks(ctx, where, args, filter.PageParams)
+}
+
+// searchSorts orders search results by relevance, the rank is compared as the float4 ts_rank returns
+var searchSorts = map[string][]sortKey[TaskSearchResult]{
+	"": {
+		{expr: "ts_rank(search_vector, q)", cast: "real", desc: true, value: func(r TaskSearchResult) string {
+			return strconv.FormatFloat(float64(r.Rank), 'g', -1, 32)
+		}},
+		{expr: "id", cast: "bigint", desc: true, value: func(r TaskSearchResult) string { return strconv.Itoa(r.Id) }},
+	},
+}
+
+// Search returns the tasks matching a websearch query ("quoted phrases", -excluded, or) best match first.
+// userId 0 searches the tasks of every user, which takes tasks.read_all
+func (tr *TaskPgRepository) Search(ctx context.Context, q string, userId int, params PageParams, actorId int, actorRole string) (Page[TaskSearchResult], error) {
+	keys, ok := resolveSort(searchSorts, params.Sort, params.Order)
+	if !ok {
+		return Page[TaskSearchResult]{}, ErrInvalidSearchSort
+	}
+
+	where := []string{"search_vector @@ q", "deleted_at IS NULL"}
+	args := []any{q, actorId, actorRole}
+	if userId == 0 {
+		where = append(where, permits("$3", PERM_TASKS_READ_ALL))
+	} else {
+		args = append(args, userId)
+		where = append(where, "user_id = $4 AND (user_id = $2 OR "+permits("$3", PERM_TASKS_READ_ALL)+")")
+	}
+
+	where, args, err := applyCursor(where, args, keys, params)
 	if err != nil {
-		return nil, err
+		return Page[TaskSearchResult]{}, err
+	}
+
+	// the highlights are marked with control characters first, so that the task text can be escaped around them
+	query := "SELECT " + taskColumns + ", ts_rank(search_vector, q), " +
+		"ts_headline('simple', title, q, 'StartSel=\x01, StopSel=\x02, HighlightAll=true'), " +
+		"ts_headline('simple', coalesce(description, ''), q, 'StartSel=\x01, StopSel=\x02, MaxFragments=2, FragmentDelimiter=\" … \"') " +
+		"FROM tasks, websearch_to_tsquery('simple', $1) q WHERE " + strings.Join(where, " AND ")
+	args = append(args, params.Limit+1)
+	query += " ORDER BY " + orderByClause(keys) + " LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := tr.pool.Query(ctx, query, args...)
+	if err != nil {
+		return Page[TaskSearchResult]{}, cursorError(err, params)
 	}
-	defer row.Close()
-
-	for row.Next() {
-		var t Task
-		err := row.Scan(&t.Id,
-			&t.UserId,
-			&t.Title,
-			&t.Description,
-			&t.IsCompleted,
-			&t.CreatedAt,
-			&t.UpdatedAt)
+	defer rows.Close()
+
+	var results []TaskSearchResult
+	for rows.Next() {
+		var r TaskSearchResult
+		err := rows.Scan(append(taskScanTargets(&r.Task), &r.Rank, &r.TitleHighlight, &r.Snippet)...)
 		if err != nil {
-			return nil, err
+			return Page[TaskSearchResult]{}, err
 		}
-		tasks = append(tasks, t)
+		r.TitleHighlight = markHighlights(r.TitleHighlight)
+		r.Snippet = markHighlights(r.Snippet)
+		results = append(results, r)
 	}
 
-	if err := row.Err(); err != nil {
-		return nil, err
+	if err := rows.Err(); err != nil {
+		return Page[TaskSearchResult]{}, cursorError(err, params)
 	}
 
-	if tasks == nil || len(tasks) == 0 {
-		return []Task{}, nil
+	page := newPage(results, keys, params)
+
+	tasks := make([]Task, len(page.Items))
+	for i := range page.Items {
+		tasks[i] = page.Items[i].Task
+	}
+	if err := tr.loadLabels(ctx, tasks); err != nil {
+		return Page[TaskSearchResult]{}, err
+	}
+	for i := range page.Items {
+		page.Items[i].Labels = tasks[i].Labels
 	}
 
-	return tasks, nil
+	return page, nil
+}
+
+// markHighlights escapes a ts_headline result and turns its \x01 \x02 markers into <mark></mark>
+func markHighlights(headline string) string {
+	headline = html.EscapeString(headline)
+	return strings.NewReplacer("\x01", "<mark>", "\x02", "</mark>").Replace(headline)
 }
 
-func (tr *TaskPgRepository) Create(ctx context.Context, task Task) (int, error) {
+// Create only puts the task into a project owned by the same user that is not archived
+func (tr *TaskPgRepository) Create(ctx context.Context, task Task, actorId int, actorRole string) (int, error) {
+	tx, err := tr.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO tasks (user_id, project_id, title, description, due_date, priority, recurrence)
+		SELECT $1::bigint, $2::bigint, $3::text, $4::text, $5::timestamptz, $6::task_priority, $7::text
+		WHERE $2::bigint IS NULL OR EXISTS (SELECT 1 FROM projects p WHERE p.id = $2 AND p.user_id = $1 AND NOT p.is_archived)
+		RETURNING id`
+
 	var id int
-	err := tr.pool.QueryRow(ctx, "INSERT INTO tasks (user_id, title, description) VALUES ($1, $2, $3) RETURNING id", task.UserId, task.Title, task.Description).Scan(&id)
+	err = tx.QueryRow(ctx, query, task.UserId, task.ProjectId, task.Title, task.Description, task.DueDate, task.Priority, task.Recurrence).Scan(&id)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrProjectNotFound
+		}
+		return 0, err
+	}
+
+	if err := recordTaskEvent(ctx, tx, id, actorId, actorRole, EVENT_CREATED, nil, &task.Title); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
 		return 0, err
 	}
 	return id, nil
 }
 
-func (tr *TaskPgRepository) Delete(ctx context.Context, id int, actorId int, actorRole string) error {
-	query := "DELETE FROM tasks WHERE id = $1 AND (user_id = $2 OR $3 = 'admin')"
-	cmdTag, err := tr.pool.Exec(ctx, query, id, actorId, actorRole)
+// CreateNextOccurrence copies a completed recurring task into its next occurrence: same owner, project,
+// title, description, priority and labels, a fresh checklist and the given due date and rule.
+// Returns 0 if the next occurrence of parent was already spawned before
+func (tr *TaskPgRepository) CreateNextOccurrence(ctx context.Context, parent Task, dueDate time.Time, recurrence string, actorId int, actorRole string) (int, error) {
+	tx, err := tr.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
 
-	if cmdTag.RowsAffected() == 0 {
-		return errors.New("task not deleted")
+	query := `INSERT INTO tasks (user_id, project_id, title, description, due_date, priority, recurrence, recurrence_parent_id)
+		SELECT user_id, project_id, title, description, $2, priority, $3, id FROM tasks WHERE id = $1
+		ON CONFLICT (recurrence_parent_id) WHERE recurrence_parent_id IS NOT NULL DO NOTHING
+		RETURNING id`
+
+	var id int
+	err = tx.QueryRow(ctx, query, parent.Id, dueDate, recurrence).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
 	}
 
+	_, err = tx.Exec(ctx, "INSERT INTO task_labels (task_id, label_id) SELECT $1, label_id FROM task_labels WHERE task_id = $2", id, parent.Id)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	_, err = tx.Exec(ctx, "INSERT INTO task_items (task_id, title, position) SELECT $1, title, position FROM task_items WHERE task_id = $2", id, parent.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := recordTaskEvent(ctx, tx, id, actorId, actorRole, EVENT_CREATED, nil, &parent.Title); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return id, nil
 }
 
-func (tr *TaskPgRepository) UpdateTitle(ctx context.Context, newTitle string, id int, actorId int, actorRole string) error {
-	query := "UPDATE tasks SET title = $1, updated_at = $2 WHERE id = $3 AND (user_id = $4 OR $5 = 'admin')"
-	cmdTag, err := tr.pool.Exec(ctx, query, newTitle, time.Now(), id, actorId, actorRole)
+// taskChange is a single column update that changeTask records as a task event
+type taskChange struct {
+	column     string // tasks column, it doubles as the event field
+	set        string // the new value, $3 refers to value
+	value      any
+	inTrash    bool  // the task must be in the trash instead of outside of it
+	notUpdated error // returned when the task does not exist or belongs to someone else
+}
+
+// changeTask applies change (and the changes in more) to a task and records who changed what in task_events,
+// in one transaction. Setting a column to the value it already has is not recorded
+func (tr *TaskPgRepository) changeTask(ctx context.Context, id int, actorId int, actorRole string, change taskChange, more ...taskChange) error {
+	tx, err := tr.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	if cmdTag.RowsAffected() == 0 {
-		return ErrTaskTitleNotUpdated
+	trashCond := "deleted_at IS NULL"
+	if change.inTrash {
+		trashCond = "deleted_at IS NOT NULL"
 	}
 
-	return nil
+	for _, c := range append([]taskChange{change}, more...) {
+		var oldValue *string
+		query := "SELECT " + eventValue(c.column) + " FROM tasks WHERE id = $1 AND (user_id = $2 OR " + permits("$3", PERM_TASKS_WRITE_ALL) + ") AND " + trashCond + " FOR UPDATE"
+		err = tx.QueryRow(ctx, query, id, actorId, actorRole).Scan(&oldValue)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return change.notUpdated
+			}
+			return err
+		}
+
+		args := []any{id, time.Now()}
+		if c.value != nil {
+			args = append(args, c.value)
+		}
+
+		var newValue *string
+		query = "UPDATE tasks SET " + c.column + " = " + c.set + ", updated_at = $2 WHERE id = $1 RETURNING " + eventValue(c.column)
+		err = tx.QueryRow(ctx, query, args...).Scan(&newValue)
+		if err != nil {
+			return err
+		}
+
+		if !equalEventValues(oldValue, newValue) {
+			err = recordTaskEvent(ctx, tx, id, actorId, actorRole, c.column, oldValue, newValue)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (tr *TaskPgRepository) UpdateDescription(ctx context.Context, newDescription string, id int, actorId int, actorRole string) error {
-	query := "UPDATE tasks SET description = $1, updated_at = $2 WHERE id = $3 AND (user_id = $4 OR $5 = 'admin')"
-	cmdTag, err := tr.pool.Exec(ctx, query, newDescription, time.Now(), id, actorId, actorRole)
+// Delete moves the task into the trash, see Restore and DeleteForever
+func (tr *TaskPgRepository) Delete(ctx context.Context, id int, actorId int, actorRole string) error {
+	return tr.changeTask(ctx, id, actorId, actorRole, taskChange{column: "deleted_at", set: "$3", value: time.Now(), notUpdated: ErrTaskNotDeleted})
+}
+
+// Restore takes a task out of the trash
+func (tr *TaskPgRepository) Restore(ctx context.Context, id int, actorId int, actorRole string) error {
+	return tr.changeTask(ctx, id, actorId, actorRole, taskChange{column: "deleted_at", set: "NULL", inTrash: true, notUpdated: ErrTaskNotInTrash})
+}
+
+// DeleteForever removes a task that is in the trash together with its checklist, labels and history
+func (tr *TaskPgRepository) DeleteForever(ctx context.Context, id int, actorId int, actorRole string) error {
+	query := "DELETE FROM tasks WHERE id = $1 AND (user_id = $2 OR " + permits("$3", PERM_TASKS_WRITE_ALL) + ") AND deleted_at IS NOT NULL"
+	cmdTag, err := tr.pool.Exec(ctx, query, id, actorId, actorRole)
 	if err != nil {
 		return err
 	}
 
 	if cmdTag.RowsAffected() == 0 {
-		return ErrTaskDescNotUpdated
+		return ErrTaskNotInTrash
 	}
 
 	return nil
 }
 
-func (tr *TaskPgRepository) SwitchTaskStatus(ctx context.Context, id int, actorId int, actorRole string) error {
-	query := "UPDATE tasks SET is_completed = NOT is_completed, updated_at = $1 WHERE id = $2 AND (user_id = $3 OR $4 = 'admin')"
-	cmdTag, err := tr.pool.Exec(ctx, query, time.Now(), id, actorId, actorRole)
+// PurgeTrash deletes every task that was moved into the trash before deletedBefore
+func (tr *TaskPgRepository) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	cmdTag, err := tr.pool.Exec(ctx, "DELETE FROM tasks WHERE deleted_at < $1", deletedBefore)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return cmdTag.RowsAffected(), nil
+}
 
-	if cmdTag.RowsAffected() == 0 {
-		return ErrTaskStatusNotSwitched
+func (tr *TaskPgRepository) UpdateTitle(ctx context.Context, newTitle string, id int, actorId int, actorRole string) error {
+	return tr.changeTask(ctx, id, actorId, actorRole, taskChange{column: "title", set: "$3", value: newTitle, notUpdated: ErrTaskTitleNotUpdated})
+}
+
+func (tr *TaskPgRepository) UpdateDescription(ctx context.Context, newDescription string, id int, actorId int, actorRole string) error {
+	return tr.changeTask(ctx, id, actorId, actorRole, taskChange{column: "description", set: "$3", value: newDescription, notUpdated: ErrTaskDescNotUpdated})
+}
+
+// UpdateDueDate sets the due date together with the recurrence pinned to it, nil clears either
+func (tr *TaskPgRepository) UpdateDueDate(ctx context.Context, newDueDate *time.Time, recurrence *string, id int, actorId int, actorRole string) error {
+	due := taskChange{column: "due_date", set: "NULL", notUpdated: ErrTaskDueDateNotUpdated}
+	if newDueDate != nil {
+		due.set, due.value = "$3", *newDueDate
 	}
+	rule := taskChange{column: "recurrence", set: "NULL"}
+	if recurrence != nil {
+		rule.set, rule.value = "$3", *recurrence
+	}
+	return tr.changeTask(ctx, id, actorId, actorRole, due, rule)
+}
 
-	return nil
+func (tr *TaskPgRepository) UpdatePriority(ctx context.Context, newPriority string, id int, actorId int, actorRole string) error {
+	return tr.changeTask(ctx, id, actorId, actorRole, taskChange{column: "priority", set: "$3", value: newPriority, notUpdated: ErrTaskPriorityNotUpdated})
 }
 
-func (tr *TaskPgRepository) GetTaskById(ctx context.Context, id int, actorId int, actorRole string) (*Task, error) {
-	query := "SELECT id, user_id, title, description, is_completed, created_at, updated_at FROM tasks WHERE id = $1 AND (user_id = $2 OR $3 = 'admin')"
+func (tr *TaskPgRepository) UpdateRecurrence(ctx context.Context, newRecurrence *string, id int, actorId int, actorRole string) error {
+	if newRecurrence == nil {
+		return tr.changeTask(ctx, id, actorId, actorRole, taskChange{column: "recurrence", set: "NULL", notUpdated: ErrTaskRecurrenceNotUpdated})
+	}
+	return tr.changeTask(ctx, id, actorId, actorRole, taskChange{column: "recurrence", set: "$3", value: *newRecurrence, notUpdated: ErrTaskRecurrenceNotUpdated})
+}
 
-	var task Task
+func (tr *TaskPgRepository) SwitchTaskStatus(ctx context.Context, id int, actorId int, actorRole string) error {
+	return tr.changeTask(ctx, id, actorId, actorRole, taskChange{column: "is_completed", set: "NOT is_completed", notUpdated: ErrTaskStatusNotSwitched})
+}
 
-	err := tr.pool.QueryRow(ctx, query, id, actorId, actorRole).Scan(&task.Id,
-		&task.UserId,
-		&task.Title,
-		&task.Description,
-		&task.IsCompleted,
-		&task.CreatedAt,
-		&task.UpdatedAt)
+func (tr *TaskPgRepository) GetTaskById(ctx context.Context, id int, actorId int, actorRole string) (*Task, error) {
+	query := "SELECT " + taskColumns + " FROM tasks WHERE id = $1 AND (user_id = $2 OR " + permits("$3", PERM_TASKS_READ_ALL) + ") AND deleted_at IS NULL"
 
+	task, err := scanTask(tr.pool.QueryRow(ctx, query, id, actorId, actorRole))
 	if err != nil {
 		return nil, err
 	}
 
-	return &task, nil
+	tasks := []Task{task}
+	if err := tr.loadLabels(ctx, tasks); err != nil {
+		return nil, err
+	}
 
-	// type Task struct {
-	//	Id          int       `json:"id"`
-	//	UserId      int       `json:"user_id"`
-	//	Title       string    `json:"title"`
-	//	Description string    `json:"description"`
-	//	IsCompleted bool      `json:"is_completed"`
-	//	CreatedAt   time.Time `json:"created_at"`
-	//	UpdatedAt   time.Time `json:"updated_at"`
-	//}
+	return &tasks[0], nil
 }
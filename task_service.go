@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"log"
 	"strings"
+	"time"
 )
 
 type TaskService struct {
@@ -13,18 +15,133 @@ func NewTaskService(repo TaskRepository) *TaskService {
 	return &TaskService{repo: repo}
 }
 
-func (ts *TaskService) GetAllTasks(ctx context.Context) ([]Task, error) {
-	return ts.repo.GetAll(ctx)
+// DueFilter turns a due query mode into a TaskFilter, "today" and "this week" are resolved
+// in the given timezone so that a task due at 23:30 in Tokyo is not reported as due tomorrow
+func DueFilter(mode string, loc *time.Location, now time.Time) (TaskFilter, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	now = now.In(loc)
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	switch mode {
+	case "":
+		return TaskFilter{}, nil
+	case DUE_OVERDUE:
+		return TaskFilter{DueBefore: &now, OnlyOpen: true}, nil
+	case DUE_TODAY:
+		endOfDay := startOfDay.AddDate(0, 0, 1)
+		return TaskFilter{DueFrom: &startOfDay, DueBefore: &endOfDay}, nil
+	case DUE_WEEK:
+		// weeks start on monday, time.Weekday starts on sunday
+		daysSinceMonday := (int(now.Weekday()) + 6) % 7
+		startOfWeek := startOfDay.AddDate(0, 0, -daysSinceMonday)
+		endOfWeek := startOfWeek.AddDate(0, 0, 7)
+		return TaskFilter{DueFrom: &startOfWeek, DueBefore: &endOfWeek}, nil
+	default:
+		return TaskFilter{}, ErrInvalidDueFilter
+	}
+}
+
+func IsValidPriority(priority string) bool {
+	switch priority {
+	case PRIORITY_NONE, PRIORITY_LOW, PRIORITY_MEDIUM, PRIORITY_HIGH, PRIORITY_URGENT:
+		return true
+	}
+	return false
 }
 
-func (ts *TaskService) GetTaskById(ctx context.Context, id int, actorId int, actorRole string) ([]Task, error) {
+func isValidSort(sort string) bool {
+	switch sort {
+	case "", SORT_ID, SORT_PRIORITY, SORT_DUE, SORT_CREATED, SORT_UPDATED, SORT_TITLE, SORT_DELETED:
+		return true
+	}
+	return false
+}
+
+func (ts *TaskService) GetAllTasks(ctx context.Context, filter TaskFilter) (Page[Task], error) {
+	if !isValidSort(filter.Sort) {
+		return Page[Task]{}, ErrInvalidSort
+	}
+	if err := validatePageParams(&filter.PageParams); err != nil {
+		return Page[Task]{}, err
+	}
+	return ts.repo.GetAll(ctx, filter)
+}
+
+func (ts *TaskService) GetTaskById(ctx context.Context, id int, filter TaskFilter, actorId int, actorRole string) (Page[Task], error) {
 	if id < 1 {
+		return Page[Task]{}, ErrIdMustBeGtZero
+	}
+	if !isValidSort(filter.Sort) {
+		return Page[Task]{}, ErrInvalidSort
+	}
+	if err := validatePageParams(&filter.PageParams); err != nil {
+		return Page[Task]{}, err
+	}
+	return ts.repo.GetByUserId(ctx, id, filter, actorId, actorRole)
+}
+
+// SearchTasks runs a full-text search over the titles and descriptions of a user's tasks, userId 0 searches everyone's
+func (ts *TaskService) SearchTasks(ctx context.Context, q string, userId int, params PageParams, actorId int, actorRole string) (Page[TaskSearchResult], error) {
+	if userId < 0 {
+		return Page[TaskSearchResult]{}, ErrIdMustBeGtZero
+	}
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return Page[TaskSearchResult]{}, ErrEmptySearchQuery
+	}
+	if err := validatePageParams(&params); err != nil {
+		return Page[TaskSearchResult]{}, err
+	}
+	return ts.repo.Search(ctx, q, userId, params, actorId, actorRole)
+}
+
+// GetTaskHistory returns every recorded change of a task, oldest first
+func (ts *TaskService) GetTaskHistory(ctx context.Context, taskId int, actorId int, actorRole string) ([]TaskEvent, error) {
+	if taskId < 1 {
 		return nil, ErrIdMustBeGtZero
 	}
-	return ts.repo.GetByUserId(ctx, id, actorId, actorRole)
+	return ts.repo.GetHistory(ctx, taskId, actorId, actorRole)
 }
 
-func (ts *TaskService) CreateNewTask(ctx context.Context, userId int, title string, description string) (int, error) {
+// normalizeRecurrence validates a rule and returns its canonical form, nil or "" clears the rule.
+// A monthly or yearly rule is pinned to the day (and month) of the due date, so that clamping to
+// a shorter month (31st -> 30th, feb 29th -> feb 28th) does not move every following occurrence
+func normalizeRecurrence(rule *string, dueDate *time.Time) (*string, error) {
+	if rule == nil || strings.TrimSpace(*rule) == "" {
+		return nil, nil
+	}
+
+	rec, err := ParseRecurrence(*rule)
+	if err != nil {
+		return nil, err
+	}
+	if dueDate != nil {
+		rec.pinAnchor(*dueDate)
+	}
+
+	normalized := rec.String()
+	return &normalized, nil
+}
+
+// repinRecurrence moves a stored rule to a new due date, see Recurrence.repin
+func repinRecurrence(rule *string, dueDate *time.Time) (*string, error) {
+	if rule == nil || dueDate == nil {
+		return rule, nil
+	}
+
+	rec, err := ParseRecurrence(*rule)
+	if err != nil {
+		return nil, err
+	}
+	rec.repin(*dueDate)
+
+	repinned := rec.String()
+	return &repinned, nil
+}
+
+func (ts *TaskService) CreateNewTask(ctx context.Context, userId int, projectId *int, title string, description string, dueDate *time.Time, priority string, recurrence *string, actorId int, actorRole string) (int, error) {
 	if userId < 1 {
 		return 0, ErrIdMustBeGtZero
 	}
@@ -40,13 +157,33 @@ func (ts *TaskService) CreateNewTask(ctx context.Context, userId int, title stri
 		desc = description
 	}
 
+	if priority == "" {
+		priority = PRIORITY_NONE
+	}
+	if !IsValidPriority(priority) {
+		return 0, ErrInvalidPriority
+	}
+
+	if projectId != nil && *projectId < 1 {
+		return 0, ErrIdMustBeGtZero
+	}
+
+	recurrence, err := normalizeRecurrence(recurrence, dueDate)
+	if err != nil {
+		return 0, err
+	}
+
 	newTask := Task{
 		UserId:      userId,
+		ProjectId:   projectId,
 		Title:       title,
 		Description: desc,
+		DueDate:     dueDate,
+		Priority:    priority,
+		Recurrence:  recurrence,
 	}
 
-	id, err := ts.repo.Create(ctx, newTask)
+	id, err := ts.repo.Create(ctx, newTask, actorId, actorRole)
 	if err != nil {
 		if IsForeignKeyViolation(err) {
 			return 0, ErrNoUserWithThisId
@@ -56,6 +193,7 @@ func (ts *TaskService) CreateNewTask(ctx context.Context, userId int, title stri
 	return id, nil
 }
 
+// DeleteTask moves the task into the trash
 func (ts *TaskService) DeleteTask(ctx context.Context, id int, actorId int, actorRole string) error {
 	if id < 1 {
 		return ErrIdMustBeGtZero
@@ -63,6 +201,56 @@ func (ts *TaskService) DeleteTask(ctx context.Context, id int, actorId int, acto
 	return ts.repo.Delete(ctx, id, actorId, actorRole)
 }
 
+// GetTrash lists the deleted tasks of a user, most recently deleted first unless another sort is given
+func (ts *TaskService) GetTrash(ctx context.Context, userId int, filter TaskFilter, actorId int, actorRole string) (Page[Task], error) {
+	filter.Trashed = true
+	if filter.Sort == "" {
+		filter.Sort = SORT_DELETED
+	}
+	return ts.GetTaskById(ctx, userId, filter, actorId, actorRole)
+}
+
+func (ts *TaskService) RestoreTask(ctx context.Context, id int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+	return ts.repo.Restore(ctx, id, actorId, actorRole)
+}
+
+// DeleteTaskForever removes a task from the trash, there is no way back
+func (ts *TaskService) DeleteTaskForever(ctx context.Context, id int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+	return ts.repo.DeleteForever(ctx, id, actorId, actorRole)
+}
+
+// PurgeTrash deletes for good the tasks that have been in the trash for longer than retention
+func (ts *TaskService) PurgeTrash(ctx context.Context, retention time.Duration) (int64, error) {
+	return ts.repo.PurgeTrash(ctx, time.Now().Add(-retention))
+}
+
+// RunTrashPurge purges the trash right away and then every interval until ctx is done
+func (ts *TaskService) RunTrashPurge(ctx context.Context, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := ts.PurgeTrash(ctx, retention)
+		if err != nil {
+			log.Println("Error purging the trash: ", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d tasks from the trash\n", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func (ts *TaskService) UpdateTitle(ctx context.Context, newTitle string, id int, actorId int, actorRole string) error {
 	if id < 1 {
 		return ErrIdMustBeGtZero
@@ -89,12 +277,97 @@ func (ts *TaskService) UpdateDescription(ctx context.Context, newDescription str
 	return ts.repo.UpdateDescription(ctx, desc, id, actorId, actorRole)
 }
 
+// UpdateDueDate moves the due date, a monthly or yearly recurrence is pinned to the new date in the same update.
+// Clearing the due date leaves the rule as it is
+func (ts *TaskService) UpdateDueDate(ctx context.Context, newDueDate *time.Time, id int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+
+	task, err := ts.repo.GetTaskById(ctx, id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+
+	recurrence, err := repinRecurrence(task.Recurrence, newDueDate)
+	if err != nil {
+		return err
+	}
+
+	return ts.repo.UpdateDueDate(ctx, newDueDate, recurrence, id, actorId, actorRole)
+}
+
+func (ts *TaskService) UpdatePriority(ctx context.Context, newPriority string, id int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+	if !IsValidPriority(newPriority) {
+		return ErrInvalidPriority
+	}
+
+	return ts.repo.UpdatePriority(ctx, newPriority, id, actorId, actorRole)
+}
+
+func (ts *TaskService) UpdateRecurrence(ctx context.Context, newRecurrence *string, id int, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+
+	task, err := ts.repo.GetTaskById(ctx, id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+
+	newRecurrence, err = normalizeRecurrence(newRecurrence, task.DueDate)
+	if err != nil {
+		return err
+	}
+
+	return ts.repo.UpdateRecurrence(ctx, newRecurrence, id, actorId, actorRole)
+}
+
+// SwitchTaskStatus flips the completion flag, completing a recurring task spawns its next occurrence
 func (ts *TaskService) SwitchTaskStatus(ctx context.Context, id int, actorId int, actorRole string) error {
 	if id < 1 {
 		return ErrIdMustBeGtZero
 	}
 
-	return ts.repo.SwitchTaskStatus(ctx, id, actorId, actorRole)
+	err := ts.repo.SwitchTaskStatus(ctx, id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+
+	task, err := ts.repo.GetTaskById(ctx, id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+	if !task.IsCompleted || task.Recurrence == nil {
+		return nil
+	}
+
+	return ts.spawnNextOccurrence(ctx, *task, actorId, actorRole)
+}
+
+// spawnNextOccurrence creates the task that follows a completed recurring task, the schedule is
+// anchored to the due date so completing late does not shift it, tasks without one recur from now
+func (ts *TaskService) spawnNextOccurrence(ctx context.Context, task Task, actorId int, actorRole string) error {
+	rec, err := ParseRecurrence(*task.Recurrence)
+	if err != nil {
+		return err
+	}
+
+	current := time.Now()
+	if task.DueDate != nil {
+		current = *task.DueDate
+	}
+
+	next, nextRule, ok := rec.Next(current)
+	if !ok {
+		return nil
+	}
+
+	_, err = ts.repo.CreateNextOccurrence(ctx, task, next, nextRule.String(), actorId, actorRole)
+	return err
 }
 
 func (ts *TaskService) GetTaskByItsId(ctx context.Context, taskId int, actorId int, actorRole string) (*Task, error) {
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDueFilter(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("no tz database: ", err)
+	}
+	// a wednesday, already thursday in Tokyo
+	now := time.Date(2026, 1, 14, 20, 0, 0, 0, time.UTC)
+	at := func(loc *time.Location, day int) *time.Time {
+		t := time.Date(2026, 1, day, 0, 0, 0, 0, loc)
+		return &t
+	}
+
+	tests := []struct {
+		mode string
+		loc  *time.Location
+		want TaskFilter
+		err  error
+	}{
+		{"", nil, TaskFilter{}, nil},
+		{DUE_OVERDUE, nil, TaskFilter{DueBefore: &now, OnlyOpen: true}, nil},
+		{DUE_TODAY, nil, TaskFilter{DueFrom: at(time.UTC, 14), DueBefore: at(time.UTC, 15)}, nil},
+		{DUE_TODAY, tokyo, TaskFilter{DueFrom: at(tokyo, 15), DueBefore: at(tokyo, 16)}, nil},
+		{DUE_WEEK, nil, TaskFilter{DueFrom: at(time.UTC, 12), DueBefore: at(time.UTC, 19)}, nil},
+		{DUE_WEEK, tokyo, TaskFilter{DueFrom: at(tokyo, 12), DueBefore: at(tokyo, 19)}, nil},
+		{"tomorrow", nil, TaskFilter{}, ErrInvalidDueFilter},
+	}
+
+	for _, tt := range tests {
+		got, err := DueFilter(tt.mode, tt.loc, now)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("DueFilter(%q, %v) error = %v, want %v", tt.mode, tt.loc, err, tt.err)
+			continue
+		}
+		if !equalTimes(got.DueFrom, tt.want.DueFrom) || !equalTimes(got.DueBefore, tt.want.DueBefore) || got.OnlyOpen != tt.want.OnlyOpen {
+			t.Errorf("DueFilter(%q, %v) = from %v before %v open %v, want from %v before %v open %v", tt.mode, tt.loc,
+				got.DueFrom, got.DueBefore, got.OnlyOpen, tt.want.DueFrom, tt.want.DueBefore, tt.want.OnlyOpen)
+		}
+	}
+}
+
+func TestTaskFilterFromQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		err   error
+	}{
+		{"?due=today&tz=Europe/Berlin&completed=false", nil},
+		{"?due=week&created_after=2026-01-01T00:00:00Z", nil},
+		{"?due=someday", ErrInvalidDueFilter},
+		{"?due=today&tz=Mars/Olympus", ErrInvalidTimezone},
+		{"?completed=maybe", ErrInvalidCompletedFilter},
+		{"?created_after=yesterday", ErrInvalidTimeFilter},
+	}
+
+	for _, tt := range tests {
+		if _, err := taskFilterFromQuery(httptest.NewRequest("GET", "/tasks"+tt.query, nil)); !errors.Is(err, tt.err) {
+			t.Errorf("taskFilterFromQuery(%q) error = %v, want %v", tt.query, err, tt.err)
+		}
+	}
+}
+
+func equalTimes(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenVersionCache keeps the users' token versions in memory, so JWTmiddleware doesn't query
+// postgres on every request. Entries expire after ttl, which bounds how long a change made by
+// another instance of the server goes unnoticed, changes made by this instance are forgotten right away
+type tokenVersionCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[int]tokenVersionEntry
+}
+
+type tokenVersionEntry struct {
+	version   int
+	expiresAt time.Time
+}
+
+func newTokenVersionCache(ttl time.Duration) *tokenVersionCache {
+	return &tokenVersionCache{
+		ttl:     ttl,
+		entries: make(map[int]tokenVersionEntry),
+	}
+}
+
+func (c *tokenVersionCache) get(userId int) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[userId]
+	if !ok {
+		return 0, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, userId)
+		return 0, false
+	}
+	return entry.version, true
+}
+
+func (c *tokenVersionCache) set(userId int, version int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[userId] = tokenVersionEntry{version: version, expiresAt: time.Now().Add(c.ttl)}
+}
+
+func (c *tokenVersionCache) forget(userId int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, userId)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, the last 6 of the 8 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := totpCode(rfc6238Secret, totpStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("totpCode at %d error = %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+
+	if _, err := totpCode("not base32!", 1); err == nil {
+		t.Error("totpCode with an invalid secret succeeded")
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := totpStep(now)
+	codeAt := func(offset int64) string {
+		code, err := totpCode(rfc6238Secret, step+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name   string
+		code   string
+		ok     bool
+		offset int64
+	}{
+		{"current step", codeAt(0), true, 0},
+		{"previous step", codeAt(-1), true, -1},
+		{"next step", codeAt(1), true, 1},
+		{"with spaces", " " + codeAt(0)[:3] + " " + codeAt(0)[3:] + " ", true, 0},
+		{"two steps ago", codeAt(-2), false, 0},
+		{"too short", codeAt(0)[:5], false, 0},
+		{"empty", "", false, 0},
+	}
+
+	for _, tt := range tests {
+		got, ok := matchTOTP(rfc6238Secret, tt.code, now)
+		if ok != tt.ok {
+			t.Errorf("%s: matchTOTP ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && got != step+tt.offset {
+			t.Errorf("%s: matchTOTP step = %d, want %d", tt.name, got, step+tt.offset)
+		}
+	}
+
+	// secrets are stored upper-case, a lower-case one must still work
+	if _, ok := matchTOTP(strings.ToLower(rfc6238Secret), codeAt(0), now); !ok {
+		t.Error("matchTOTP with a lower-case secret failed")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RECOVERY_CODE_COUNT {
+		t.Fatalf("generateRecoveryCodes returned %d codes, want %d", len(codes), RECOVERY_CODE_COUNT)
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 9 || code[4] != '-' || normalizeRecoveryCode(code) != code {
+			t.Errorf("recovery code %q is not in the xxxx-xxxx form", code)
+		}
+		if seen[code] {
+			t.Errorf("recovery code %q was generated twice", code)
+		}
+		seen[code] = true
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"7kq2-mx9d", "7kq2-mx9d"},
+		{"7KQ2-MX9D", "7kq2-mx9d"},
+		{" 7kq2mx9d ", "7kq2-mx9d"},
+		{"7kq2", "7kq2"},
+	}
+	for _, tt := range tests {
+		if got := normalizeRecoveryCode(tt.input); got != tt.want {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
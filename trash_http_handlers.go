@@ -0,0 +1,125 @@
+package main
+
+import (
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+)
+
+// deleted tasks end up in the trash under /me/trash, they can be restored or deleted for good until
+// the background purge removes them after TRASH_RETENTION
+
+// GetTrashHTTP lists the trash, it accepts the same query params as GetTaskByUserIdHTTP and sorts by ?sort=deleted by default
+func (s *Server) GetTrashHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetId, ok := ctx.Value(targetIdContextKey).(int)
+	if !ok {
+		log.Println("Error getting target user id from context")
+		http.Error(w, "Unauthorized", http.StatusInternalServerError)
+		return
+	}
+
+	filter, err := taskFilterFromQuery(r)
+	if err != nil {
+		log.Println("Error parsing task filter: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tasks, err := s.taskSvc.GetTrash(ctx, targetId, filter, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting trash: ", err)
+		http.Error(w, err.Error(), listErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, mapPage(tasks, newTaskResponse))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) RestoreTaskHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.taskSvc.RestoreTask(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error restoring task: ", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	task, err := s.taskSvc.GetTaskByItsId(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting task by id: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, newTaskResponse(task))
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) DeleteTaskForeverHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idInt, err := ConvertToInt(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Println("Error parsing id: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.taskSvc.DeleteTaskForever(ctx, idInt, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error deleting task forever: ", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	response := map[string]any{
+		"id":     idInt,
+		"status": "Task permanently deleted",
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// two-factor authentication is managed under /me/2fa: enroll returns a secret, confirm enables it with
+// the first code and returns the recovery codes. Once enabled, /login answers with a challenge that
+// /login/2fa completes. Staff with users.update can reset the 2FA of a user who lost their device
+
+// twoFactorErrorStatus tells wrong codes and states apart from failures of the 2FA store
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidTwoFactorCode),
+		errors.Is(err, ErrTwoFactorNotEnrolled):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrTwoFactorAlreadyEnabled):
+		return http.StatusConflict
+	case errors.Is(err, ErrTwoFactorStillRequired),
+		errors.Is(err, ErrTwoFactorRequired):
+		return http.StatusForbidden
+	case errors.Is(err, ErrTwoFactorLocked):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrUserNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (s *Server) GetTwoFactorStatusHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := s.twoFactorSvc.GetStatus(ctx, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting two-factor status: ", err)
+		http.Error(w, err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, status)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) EnrollTwoFactorHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.userSvc.GetUserById(ctx, claims.UserID, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting user by id: ", err)
+		http.Error(w, err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	secret, uri, err := s.twoFactorSvc.Enroll(ctx, user.Id, user.Name)
+	if err != nil {
+		log.Println("Error enrolling two-factor authentication: ", err)
+		http.Error(w, err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusCreated)
+	response := map[string]any{
+		"secret":      secret,
+		"otpauth_uri": uri,
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) ConfirmTwoFactorHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	codes, err := s.twoFactorSvc.Confirm(ctx, claims.UserID, input.Code)
+	if err != nil {
+		log.Println("Error confirming two-factor authentication: ", err)
+		http.Error(w, err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, map[string]any{"recovery_codes": codes})
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) RegenerateRecoveryCodesHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	codes, err := s.twoFactorSvc.RegenerateRecoveryCodes(ctx, claims.UserID, input.Code)
+	if err != nil {
+		log.Println("Error regenerating recovery codes: ", err)
+		http.Error(w, err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err = EncodeJSONhelper(w, map[string]any{"recovery_codes": codes})
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) DisableTwoFactorHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	err := s.twoFactorSvc.Disable(ctx, claims.UserID, claims.Role, input.Code)
+	if err != nil {
+		log.Println("Error disabling two-factor authentication: ", err)
+		http.Error(w, err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	response := map[string]any{
+		"id":     claims.UserID,
+		"status": "Two-factor authentication disabled",
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ResetTwoFactorHTTP turns off the 2FA of a user without a code, for users who lost their device
+func (s *Server) ResetTwoFactorHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, ok := ctx.Value(userContextKey).(*Claims)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetId, ok := ctx.Value(targetIdContextKey).(int)
+	if !ok {
+		log.Println("Error getting target user id from context")
+		http.Error(w, "Unauthorized", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := s.userSvc.GetUserById(ctx, targetId, claims.UserID, claims.Role)
+	if err != nil {
+		log.Println("Error getting user by id: ", err)
+		http.Error(w, err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	// like the users predicates, a role can only reset users whose role has no permission it lacks
+	manages, err := s.roleSvc.CanManage(ctx, claims.Role, user.Role)
+	if err != nil {
+		log.Println("Error getting role permissions: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !manages {
+		http.Error(w, ErrRoleTooPowerful.Error(), http.StatusForbidden)
+		return
+	}
+
+	err = s.twoFactorSvc.Reset(ctx, targetId)
+	if err != nil {
+		log.Println("Error resetting two-factor authentication: ", err)
+		http.Error(w, err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	response := map[string]any{
+		"id":     targetId,
+		"status": "Two-factor authentication reset",
+	}
+	err = EncodeJSONhelper(w, response)
+	if err != nil {
+		log.Println("Error encoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type TwoFactorPgRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewTwoFactorPgRepository(pool *pgxpool.Pool) *TwoFactorPgRepository {
+	return &TwoFactorPgRepository{
+		pool: pool,
+	}
+}
+
+func (tr *TwoFactorPgRepository) Get(ctx context.Context, userId int) (*TwoFactor, error) {
+	var t TwoFactor
+	query := "SELECT user_id, secret, confirmed_at, last_used_step, failed_attempts, locked_until FROM user_totp WHERE user_id = $1"
+	err := tr.pool.QueryRow(ctx, query, userId).Scan(&t.UserId,
+		&t.Secret,
+		&t.ConfirmedAt,
+		&t.LastUsedStep,
+		&t.FailedAttempts,
+		&t.LockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Enroll starts over an unconfirmed enrollment with a new secret, a confirmed one is left alone
+func (tr *TwoFactorPgRepository) Enroll(ctx context.Context, userId int, secret string) error {
+	query := `INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, failed_attempts = 0, locked_until = NULL, created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL`
+	cmdTag, err := tr.pool.Exec(ctx, query, userId, secret)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrTwoFactorAlreadyEnabled
+	}
+	return nil
+}
+
+// Confirm enables the enrollment with the step of its first code and stores the first recovery codes
+func (tr *TwoFactorPgRepository) Confirm(ctx context.Context, userId int, step int64, codeHashes []string) error {
+	tx, err := tr.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := "UPDATE user_totp SET confirmed_at = $1, last_used_step = $2, failed_attempts = 0 WHERE user_id = $3 AND confirmed_at IS NULL"
+	cmdTag, err := tx.Exec(ctx, query, time.Now(), step, userId)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrTwoFactorAlreadyEnabled
+	}
+
+	if err := insertRecoveryCodes(ctx, tx, userId, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// UseStep accepts a code of step once: codes of the last used step or earlier ones are replays
+func (tr *TwoFactorPgRepository) UseStep(ctx context.Context, userId int, step int64) error {
+	query := "UPDATE user_totp SET last_used_step = $1, failed_attempts = 0 WHERE user_id = $2 AND confirmed_at IS NOT NULL AND last_used_step < $1"
+	cmdTag, err := tr.pool.Exec(ctx, query, step, userId)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// RecordFailure counts a wrong code, the maxAttempts-th one in a row locks the second factor until lockedUntil
+func (tr *TwoFactorPgRepository) RecordFailure(ctx context.Context, userId int, maxAttempts int, lockedUntil time.Time) error {
+	query := `UPDATE user_totp SET
+		locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN $3 ELSE locked_until END,
+		failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END
+		WHERE user_id = $1`
+	_, err := tr.pool.Exec(ctx, query, userId, maxAttempts, lockedUntil)
+	return err
+}
+
+func (tr *TwoFactorPgRepository) ReplaceRecoveryCodes(ctx context.Context, userId int, codeHashes []string) error {
+	tx, err := tr.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertRecoveryCodes(ctx, tx, userId, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// insertRecoveryCodes replaces every recovery code of the user, used or not
+func insertRecoveryCodes(ctx context.Context, tx pgx.Tx, userId int, codeHashes []string) error {
+	_, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[])", userId, codeHashes)
+	return err
+}
+
+func (tr *TwoFactorPgRepository) UseRecoveryCode(ctx context.Context, userId int, codeHash string) error {
+	query := `UPDATE recovery_codes SET used_at = $1
+		WHERE id = (SELECT id FROM recovery_codes WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL LIMIT 1)`
+	cmdTag, err := tr.pool.Exec(ctx, query, time.Now(), userId, codeHash)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (tr *TwoFactorPgRepository) CountRecoveryCodes(ctx context.Context, userId int) (int, error) {
+	var count int
+	err := tr.pool.QueryRow(ctx, "SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL", userId).Scan(&count)
+	return count, err
+}
+
+func (tr *TwoFactorPgRepository) Disable(ctx context.Context, userId int) error {
+	tx, err := tr.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	cmdTag, err := tx.Exec(ctx, "DELETE FROM user_totp WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrTwoFactorNotEnrolled
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
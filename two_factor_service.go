@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type TwoFactorService struct {
+	repo        TwoFactorRepository
+	settingsSvc *SettingsService
+	roleSvc     *RoleService
+}
+
+func NewTwoFactorService(repo TwoFactorRepository, settingsSvc *SettingsService, roleSvc *RoleService) *TwoFactorService {
+	return &TwoFactorService{repo: repo, settingsSvc: settingsSvc, roleSvc: roleSvc}
+}
+
+// requiredFor tells whether role must keep 2FA, staff roles must while require_admin_2fa is on
+func (tf *TwoFactorService) requiredFor(ctx context.Context, role string) (bool, error) {
+	staff, err := tf.roleSvc.IsStaff(ctx, role)
+	if err != nil || !staff {
+		return false, err
+	}
+	return tf.settingsSvc.RequireAdminTwoFactor(ctx)
+}
+
+// IsEnabled tells whether the login of the user needs a second factor
+func (tf *TwoFactorService) IsEnabled(ctx context.Context, userId int) (bool, error) {
+	t, err := tf.repo.Get(ctx, userId)
+	if errors.Is(err, ErrTwoFactorNotEnrolled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return t.ConfirmedAt != nil, nil
+}
+
+func (tf *TwoFactorService) GetStatus(ctx context.Context, userId int, role string) (*TwoFactorStatus, error) {
+	enabled, err := tf.IsEnabled(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	codesLeft, err := tf.repo.CountRecoveryCodes(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	required, err := tf.requiredFor(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorStatus{Enabled: enabled, RecoveryCodesLeft: codesLeft, Required: required}, nil
+}
+
+// Enroll creates a new secret, 2FA is enabled only once Confirm gets a code generated from it
+func (tf *TwoFactorService) Enroll(ctx context.Context, userId int, account string) (secret string, uri string, err error) {
+	secret, err = generateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := tf.repo.Enroll(ctx, userId, secret); err != nil {
+		return "", "", err
+	}
+	return secret, totpURI(secret, account), nil
+}
+
+// Confirm enables 2FA and returns the recovery codes, the only time they are shown
+func (tf *TwoFactorService) Confirm(ctx context.Context, userId int, code string) ([]string, error) {
+	t, err := tf.repo.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if t.ConfirmedAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	step, ok := matchTOTP(t.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := tf.repo.Confirm(ctx, userId, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyCode checks a TOTP code of an enabled enrollment, every code works once.
+// Wrong codes count towards the lockout
+func (tf *TwoFactorService) VerifyCode(ctx context.Context, userId int, code string) error {
+	t, err := tf.enabled(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	step, ok := matchTOTP(t.Secret, code, time.Now())
+	if !ok {
+		return tf.fail(ctx, userId)
+	}
+	return tf.repo.UseStep(ctx, userId, step)
+}
+
+// VerifyRecoveryCode uses up a recovery code
+func (tf *TwoFactorService) VerifyRecoveryCode(ctx context.Context, userId int, code string) error {
+	if _, err := tf.enabled(ctx, userId); err != nil {
+		return err
+	}
+
+	err := tf.repo.UseRecoveryCode(ctx, userId, hashToken(normalizeRecoveryCode(code)))
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		return tf.fail(ctx, userId)
+	}
+	return err
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, it takes a current TOTP code
+func (tf *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userId int, code string) ([]string, error) {
+	if err := tf.VerifyCode(ctx, userId, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := tf.repo.ReplaceRecoveryCodes(ctx, userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns 2FA off with a current TOTP code, staff roles can't while require_admin_2fa is on
+func (tf *TwoFactorService) Disable(ctx context.Context, userId int, role string, code string) error {
+	required, err := tf.requiredFor(ctx, role)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorStillRequired
+	}
+
+	if err := tf.VerifyCode(ctx, userId, code); err != nil {
+		return err
+	}
+	return tf.repo.Disable(ctx, userId)
+}
+
+// Reset turns 2FA off without a code, for admins helping users who lost their device
+func (tf *TwoFactorService) Reset(ctx context.Context, userId int) error {
+	if userId < 1 {
+		return ErrIdMustBeGtZero
+	}
+	return tf.repo.Disable(ctx, userId)
+}
+
+// enabled returns the confirmed enrollment of the user unless it is locked
+func (tf *TwoFactorService) enabled(ctx context.Context, userId int) (*TwoFactor, error) {
+	t, err := tf.repo.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if t.ConfirmedAt == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if t.LockedUntil != nil && time.Now().Before(*t.LockedUntil) {
+		return nil, ErrTwoFactorLocked
+	}
+	return t, nil
+}
+
+func (tf *TwoFactorService) fail(ctx context.Context, userId int) error {
+	if err := tf.repo.RecordFailure(ctx, userId, TWO_FACTOR_MAX_ATTEMPTS, time.Now().Add(TWO_FACTOR_LOCKOUT)); err != nil {
+		return err
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+func newRecoveryCodes() (codes []string, hashes []string, err error) {
+	codes, err = generateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes = make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
@@ -2,30 +2,53 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 )
 
 // this is all for admin, i.e., you can view all users, change their roles, etc.
 // in the tasks section you can also do the same
-// this is only for users, not for tasks and only for admins
+// this is only for users, not for tasks and only for staff roles, each route checks its permission in Routes
+
+// userFilterFromQuery reads ?created_after and ?updated_before (RFC 3339) and the page params
+// ?limit, ?cursor, ?sort=id|name|created|updated and ?order=asc|desc
+func userFilterFromQuery(r *http.Request) (UserFilter, error) {
+	var filter UserFilter
+	var err error
+
+	filter.PageParams, err = pageParamsFromQuery(r)
+	if err != nil {
+		return UserFilter{}, err
+	}
+	filter.CreatedAfter, err = timeFromQuery(r, "created_after")
+	if err != nil {
+		return UserFilter{}, err
+	}
+	filter.UpdatedBefore, err = timeFromQuery(r, "updated_before")
+	if err != nil {
+		return UserFilter{}, err
+	}
+	return filter, nil
+}
 
 func (s *Server) GetAllUsersHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	claims, ok := ctx.Value(userContextKey).(*Claims)
-	if !ok || claims.Role != ADMIN {
-		log.Printf("This is for admins only! Unsafe request for GetAllUsers: %s with id %d\n", claims.Role, claims.UserID)
-		http.Error(w, "This is for admins only!", http.StatusForbidden)
+	filter, err := userFilterFromQuery(r)
+	if err != nil {
+		log.Println("Error parsing user filter: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	users, err := s.userSvc.GetAllUsers(ctx)
+
+	users, err := s.userSvc.GetAllUsers(ctx, filter)
 	if err != nil {
 		log.Println("Error getting all users: ", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), listErrorStatus(err))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	err = EncodeJSONhelper(w, users)
+	err = EncodeJSONhelper(w, mapPage(users, newUserResponse))
 	if err != nil {
 		log.Println("Error encoding JSON: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -57,7 +80,7 @@ func (s *Server) GetUserByIdHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	err = EncodeJSONhelper(w, user)
+	err = EncodeJSONhelper(w, newUserResponse(user))
 	if err != nil {
 		log.Println("Error encoding JSON: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -68,7 +91,7 @@ func (s *Server) GetUserByIdHTTP(w http.ResponseWriter, r *http.Request) {
 func (s *Server) CreateNewUserHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	var user User
+	var user CreateUserRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
 		log.Println("Error decoding JSON: ", err)
@@ -130,7 +153,7 @@ func (s *Server) RenameUserHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	err = EncodeJSONhelper(w, user)
+	err = EncodeJSONhelper(w, newUserResponse(user))
 	if err != nil {
 		log.Println("Error encoding JSON: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -172,7 +195,11 @@ func (s *Server) ChangeUserPasswordHTTP(w http.ResponseWriter, r *http.Request)
 
 	if err != nil {
 		log.Println("Error changing user password: ", err)
-		http.Error(w, err.Error(), http.StatusForbidden)
+		status := http.StatusForbidden
+		if errors.Is(err, ErrWeakPassword) || errors.Is(err, ErrNewPasswordIsSame) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
 
@@ -186,7 +213,7 @@ func (s *Server) ChangeUserPasswordHTTP(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 
-	err = EncodeJSONhelper(w, user)
+	err = EncodeJSONhelper(w, newUserResponse(user))
 	if err != nil {
 		log.Println("Error encoding JSON: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -215,7 +242,11 @@ func (s *Server) DeleteUserHTTP(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Println("Error deleting user: ", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrLastAdmin) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
 
@@ -236,9 +267,9 @@ func (s *Server) DeleteUserHTTP(w http.ResponseWriter, r *http.Request) {
 func (s *Server) UpdateRoleHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	claims, ok := ctx.Value(userContextKey).(*Claims)
-	if !ok || claims.Role != ADMIN {
-		log.Printf("This is for admins only! Unsafe request for UpdateRole: %s with id %d\n", claims.Role, claims.UserID)
-		http.Error(w, "This is for admins only!", http.StatusForbidden)
+	if !ok {
+		log.Println("Error getting user id from context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -249,10 +280,36 @@ func (s *Server) UpdateRoleHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := s.userSvc.UpdateUserRole(ctx, targetId, claims.UserID, claims.Role)
+	var input struct {
+		Role    string `json:"role"`
+		Confirm bool   `json:"confirm"` // needed to change your own role
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Println("Error decoding JSON: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	err := s.userSvc.UpdateUserRole(ctx, targetId, input.Role, input.Confirm, s.newAuditEntry(r, claims))
 	if err != nil {
 		log.Println("Error updating user role: ", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrInvalidRoleName), errors.Is(err, ErrRoleNotFound), errors.Is(err, ErrIdMustBeGtZero):
+			status = http.StatusBadRequest
+		case errors.Is(err, ErrRoleTooPowerful):
+			status = http.StatusForbidden
+		case errors.Is(err, ErrUserNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, ErrLastAdmin):
+			status = http.StatusConflict
+		case errors.Is(err, ErrRoleChangeNotConfirmed):
+			status = http.StatusPreconditionRequired
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
 
@@ -264,7 +321,7 @@ func (s *Server) UpdateRoleHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	err = EncodeJSONhelper(w, user)
+	err = EncodeJSONhelper(w, newUserResponse(user))
 	if err != nil {
 		log.Println("Error encoding JSON: ", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,37 +20,92 @@ func NewUserPgRepository(pool *pgxpool.Pool) *UserPgRepository {
 	}
 }
 
-func (ur *UserPgRepository) GetAll(ctx context.Context) ([]User, error) {
-	rows, err := ur.pool.Query(ctx, "SELECT id, name, password, created_at, updated_at, role FROM users")
+var (
+	userIdAsc  = sortKey[User]{expr: "id", cast: "bigint", value: func(u User) string { return strconv.Itoa(u.Id) }}
+	userIdDesc = sortKey[User]{expr: "id", cast: "bigint", desc: true, value: userIdAsc.value}
+)
+
+// userSorts maps the user orderings to their keyset ordering, id is always the last tie-breaker
+var userSorts = map[string][]sortKey[User]{
+	"":      {userIdAsc},
+	SORT_ID: {userIdAsc},
+	SORT_NAME: {
+		{expr: "name", cast: "text", value: func(u User) string { return u.Name }},
+		userIdAsc,
+	},
+	SORT_CREATED: {
+		{expr: "created_at", cast: "timestamptz", desc: true, value: func(u User) string { return formatCursorTime(u.CreatedAt) }},
+		userIdDesc,
+	},
+	SORT_UPDATED: {
+		{expr: "updated_at", cast: "timestamptz", desc: true, value: func(u User) string { return formatCursorTime(u.UpdatedAt) }},
+		userIdDesc,
+	},
+}
+
+func (ur *UserPgRepository) GetAll(ctx context.Context, filter UserFilter) (Page[User], error) {
+	keys, ok := resolveSort(userSorts, filter.Sort, filter.Order)
+	if !ok {
+		return Page[User]{}, ErrInvalidUserSort
+	}
+
+	var where []string
+	var args []any
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		where = append(where, "created_at > $"+strconv.Itoa(len(args)))
+	}
+	if filter.UpdatedBefore != nil {
+		args = append(args, *filter.UpdatedBefore)
+		where = append(where, "updated_at < $"+strconv.Itoa(len(args)))
+	}
+
+	where, args, err := applyCursor(where, args, keys, filter.PageParams)
 	if err != nil {
-		return nil, err
+		return Page[User]{}, err
+	}
+
+	// the listing never needs the password hashes
+	query := "SELECT id, name, created_at, updated_at, role, email, email_verified_at FROM users"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, filter.Limit+1)
+	query += " ORDER BY " + orderByClause(keys) + " LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := ur.pool.Query(ctx, query, args...)
+	if err != nil {
+		return Page[User]{}, cursorError(err, filter.PageParams)
 	}
 	defer rows.Close()
 
 	var users []User
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.Id, &user.Name, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.Role)
+		err := rows.Scan(&user.Id, &user.Name, &user.CreatedAt, &user.UpdatedAt, &user.Role, &user.Email, &user.EmailVerifiedAt)
 		if err != nil {
-			return nil, err
+			return Page[User]{}, err
 		}
 		users = append(users, user)
 	}
-	if users == nil || len(users) == 0 {
-		return []User{}, nil
+	if err := rows.Err(); err != nil {
+		return Page[User]{}, cursorError(err, filter.PageParams)
 	}
-	return users, nil
+	return newPage(users, keys, filter.PageParams), nil
 }
 
 func (ur *UserPgRepository) GetById(ctx context.Context, id int, actorId int, actorRole string) (*User, error) {
 	var u User
-	query := "SELECT id, name, password, created_at, updated_at, role FROM users WHERE id = $1 AND (id = $2 OR $3 = 'admin')"
+	query := "SELECT id, name, password, created_at, updated_at, role, email, email_verified_at, token_version FROM users WHERE id = $1 AND (id = $2 OR " + permits("$3", PERM_USERS_READ) + ")"
 	err := ur.pool.QueryRow(ctx, query, id, actorId, actorRole).Scan(&u.Id,
 		&u.Name,
 		&u.Password,
 		&u.CreatedAt,
 		&u.UpdatedAt,
-		&u.Role)
+		&u.Role,
+		&u.Email,
+		&u.EmailVerifiedAt,
+		&u.TokenVersion)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -68,7 +125,7 @@ func (ur *UserPgRepository) Create(ctx context.Context, user User) (int, error)
 }
 
 func (ur *UserPgRepository) UpdatePassword(ctx context.Context, id int, newHash string, actorId int, actorRole string) error {
-	query := "UPDATE users SET password = $1, updated_at = $2 WHERE id = $3 AND ($3 = $4 OR $5 = 'admin')"
+	query := "UPDATE users SET password = $1, token_version = token_version + 1, updated_at = $2 WHERE id = $3 AND ($3 = $4 OR (" + permits("$5", PERM_USERS_UPDATE) + " AND " + manages("$5", "users.role") + "))"
 	cmdTag, err := ur.pool.Exec(ctx, query, newHash, time.Now(), id, actorId, actorRole)
 	if err != nil {
 		return err
@@ -82,7 +139,7 @@ func (ur *UserPgRepository) UpdatePassword(ctx context.Context, id int, newHash
 }
 
 func (ur *UserPgRepository) UpdateName(ctx context.Context, id int, newName string, actorId int, actorRole string) error {
-	query := "UPDATE users SET name = $1, updated_at = $2 WHERE id = $3 AND ($3 = $4 OR $5 = 'admin')"
+	query := "UPDATE users SET name = $1, updated_at = $2 WHERE id = $3 AND ($3 = $4 OR (" + permits("$5", PERM_USERS_UPDATE) + " AND " + manages("$5", "users.role") + "))"
 
 	cmdTag, err := ur.pool.Exec(ctx, query, newName, time.Now(), id, actorId, actorRole)
 	if err != nil {
@@ -96,41 +153,124 @@ func (ur *UserPgRepository) UpdateName(ctx context.Context, id int, newName stri
 	return nil
 }
 
+// Delete removes the user, the last admin can't be deleted (see UpdateRole)
 func (ur *UserPgRepository) Delete(ctx context.Context, id int, actorId int, actorRole string) error {
-	query := "DELETE FROM users WHERE id = $1 AND (id = $2 OR $3 = 'admin')"
+	tx, err := ur.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
 
-	cmdTag, err := ur.pool.Exec(ctx, query, id, actorId, actorRole)
+	admins, err := lockAdmins(ctx, tx)
 	if err != nil {
 		return err
 	}
 
-	if cmdTag.RowsAffected() == 0 {
-		return ErrUserNotFound
+	var role string
+	query := "DELETE FROM users WHERE id = $1 AND (id = $2 OR (" + permits("$3", PERM_USERS_DELETE) + " AND " + manages("$3", "users.role") + ")) RETURNING role"
+	err = tx.QueryRow(ctx, query, id, actorId, actorRole).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if role == ADMIN && admins <= 1 {
+		return ErrLastAdmin
 	}
 
-	return nil
+	return tx.Commit(ctx)
 }
 
-func (ur *UserPgRepository) UpdateRole(ctx context.Context, id int, newRole string) error {
-	cmdTag, err := ur.pool.Exec(ctx, "UPDATE users SET role = $1, updated_at = $2 WHERE id = $3", newRole, time.Now(), id)
+// lockAdmins locks every admin and counts them. Locking them all before changing one serializes two
+// admins demoting or deleting each other at once, the second one sees that only one admin is left
+func lockAdmins(ctx context.Context, tx pgx.Tx) (int, error) {
+	rows, err := tx.Query(ctx, "SELECT id FROM users WHERE role = $1 ORDER BY id FOR UPDATE", ADMIN)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	if cmdTag.RowsAffected() == 0 {
-		return ErrSwitchRole
+	defer rows.Close()
+
+	admins := 0
+	for rows.Next() {
+		admins++
 	}
-	return nil
+	return admins, rows.Err()
+}
+
+// UpdateRole gives the user newRole and records it in the admin audit log, in one transaction. The
+// actor must have every permission of the old and the new role. It returns false when the user already has newRole
+func (ur *UserPgRepository) UpdateRole(ctx context.Context, id int, newRole string, audit AuditEntry) (bool, error) {
+	tx, err := ur.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	admins, err := lockAdmins(ctx, tx)
+	if err != nil {
+		return false, err
+	}
+
+	var oldRole string
+	err = tx.QueryRow(ctx, "SELECT role FROM users WHERE id = $1 FOR UPDATE", id).Scan(&oldRole)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, ErrUserNotFound
+		}
+		return false, err
+	}
+	if oldRole == newRole {
+		return false, nil
+	}
+
+	var allowed bool
+	err = tx.QueryRow(ctx, "SELECT "+manages("$1", "$2")+" AND "+manages("$1", "$3"), audit.ActorRole, oldRole, newRole).Scan(&allowed)
+	if err != nil {
+		return false, err
+	}
+	if !allowed {
+		return false, ErrRoleTooPowerful
+	}
+	if oldRole == ADMIN && admins <= 1 {
+		return false, ErrLastAdmin
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE users SET role = $1, token_version = token_version + 1, updated_at = $2 WHERE id = $3", newRole, time.Now(), id)
+	if err != nil {
+		if IsForeignKeyViolation(err) {
+			return false, ErrRoleNotFound
+		}
+		return false, err
+	}
+
+	audit.OldValue = map[string]any{"role": oldRole}
+	audit.NewValue = map[string]any{"role": newRole}
+	if err := recordAdminAudit(ctx, tx, audit); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
+// Authenticate looks a user up by name or by verified email, a name wins over another user's email
 func (ur *UserPgRepository) Authenticate(ctx context.Context, name string) (*User, error) {
 	var user User
-	err := ur.pool.QueryRow(ctx, "SELECT id, name, password, created_at, updated_at, role FROM users WHERE name = $1",
-		name).Scan(&user.Id,
+	query := `SELECT id, name, password, created_at, updated_at, role, email, email_verified_at, token_version FROM users
+		WHERE name = $1 OR (email = lower($1) AND email_verified_at IS NOT NULL)
+		ORDER BY name = $1 DESC LIMIT 1`
+	err := ur.pool.QueryRow(ctx, query, name).Scan(&user.Id,
 		&user.Name,
 		&user.Password,
 		&user.CreatedAt,
 		&user.UpdatedAt,
-		&user.Role)
+		&user.Role,
+		&user.Email,
+		&user.EmailVerifiedAt,
+		&user.TokenVersion)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -141,3 +281,58 @@ func (ur *UserPgRepository) Authenticate(ctx context.Context, name string) (*Use
 
 	return &user, nil
 }
+
+// RehashPassword swaps the hash of an unchanged password for a new one, unless the password was
+// changed in the meantime. token_version and updated_at stay the same
+func (ur *UserPgRepository) RehashPassword(ctx context.Context, id int, oldHash string, newHash string) error {
+	_, err := ur.pool.Exec(ctx, "UPDATE users SET password = $1 WHERE id = $2 AND password = $3", newHash, id, oldHash)
+	return err
+}
+
+// UpdateEmail sets a new, unverified email, nil removes it. Unverified emails don't have to be unique,
+// the address is only checked against other accounts when it gets verified
+func (ur *UserPgRepository) UpdateEmail(ctx context.Context, id int, newEmail *string, actorId int, actorRole string) error {
+	query := "UPDATE users SET email = $1, email_verified_at = NULL, updated_at = $2 WHERE id = $3 AND ($3 = $4 OR (" + permits("$5", PERM_USERS_UPDATE) + " AND " + manages("$5", "users.role") + "))"
+	cmdTag, err := ur.pool.Exec(ctx, query, newEmail, time.Now(), id, actorId, actorRole)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// VerifyEmail marks email as verified if it is still the user's email, ErrEmailTaken when another
+// account has verified it first
+func (ur *UserPgRepository) VerifyEmail(ctx context.Context, id int, email string) error {
+	query := "UPDATE users SET email_verified_at = COALESCE(email_verified_at, $1) WHERE id = $2 AND email = $3"
+	cmdTag, err := ur.pool.Exec(ctx, query, time.Now(), id, email)
+	if err != nil {
+		if IsUniqueViolation(err) {
+			return ErrEmailTaken
+		}
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return ErrInvalidVerificationToken
+	}
+
+	return nil
+}
+
+// GetTokenVersion returns the token version of a user, access tokens with another version are rejected
+func (ur *UserPgRepository) GetTokenVersion(ctx context.Context, id int) (int, error) {
+	var version int
+	err := ur.pool.QueryRow(ctx, "SELECT token_version FROM users WHERE id = $1", id).Scan(&version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+	return version, nil
+}
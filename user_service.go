@@ -3,19 +3,37 @@ package main
 import (
 	"context"
 	"errors"
+	"log"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 type UserService struct {
-	repo UserRepository
+	repo     UserRepository
+	hasher   PasswordHasher
+	policy   *PasswordPolicy
+	versions *tokenVersionCache
+	sessions RefreshTokenRepository
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+}
+
+func NewUserService(repo UserRepository, hasher PasswordHasher, policy *PasswordPolicy, sessions RefreshTokenRepository) *UserService {
+	return &UserService{repo: repo, hasher: hasher, policy: policy, versions: newTokenVersionCache(TOKEN_VERSION_CACHE_TTL), sessions: sessions}
 }
 
-func NewUserService(repo UserRepository) *UserService {
-	return &UserService{repo: repo}
+// PasswordPolicy is the policy new passwords are checked against
+func (uservice *UserService) PasswordPolicy() *PasswordPolicy {
+	return uservice.policy
 }
 
-func (uservice *UserService) GetAllUsers(ctx context.Context) ([]User, error) {
-	return uservice.repo.GetAll(ctx)
+func (uservice *UserService) GetAllUsers(ctx context.Context, filter UserFilter) (Page[User], error) {
+	if err := validatePageParams(&filter.PageParams); err != nil {
+		return Page[User]{}, err
+	}
+	return uservice.repo.GetAll(ctx, filter)
 }
 
 func (uservice *UserService) GetUserById(ctx context.Context, id int, actorId int, actorRole string) (*User, error) {
@@ -25,15 +43,27 @@ func (uservice *UserService) GetUserById(ctx context.Context, id int, actorId in
 	return uservice.repo.GetById(ctx, id, actorId, actorRole)
 }
 
+// validateName rejects names with an @: login takes a name over a verified email, so a user named after
+// another user's email would receive that user's logins and password resets
+func validateName(name string) error {
+	if strings.Contains(name, "@") {
+		return ErrNameIsEmail
+	}
+	return nil
+}
+
 func (uservice *UserService) CreateNewUser(ctx context.Context, name string, password string) (int, error) {
 	if len(strings.TrimSpace(name)) < 1 {
 		return 0, ErrIdMustBeGtZero
 	}
-	if len(strings.TrimSpace(password)) < 6 {
-		return 0, ErrPasswordMustBeGt6
+	if err := validateName(name); err != nil {
+		return 0, err
+	}
+	if err := uservice.policy.Validate(password, name); err != nil {
+		return 0, err
 	}
 
-	encryptPassword, err := Encrypter(password)
+	encryptPassword, err := uservice.hasher.Hash(password)
 	if err != nil {
 		return 0, err
 	}
@@ -49,6 +79,9 @@ func (uservice *UserService) RenameUser(ctx context.Context, id int, newName str
 	if len(newName) < 1 {
 		return ErrLenNameIsZero
 	}
+	if err := validateName(newName); err != nil {
+		return err
+	}
 	if id < 1 {
 		return ErrIdMustBeGtZero
 	}
@@ -59,17 +92,12 @@ func (uservice *UserService) RenameUser(ctx context.Context, id int, newName str
 	return nil
 }
 
+// ChangeUsersPass sets a new password after checking the old one and ends every login session of the user,
+// like a password reset does
 func (uservice *UserService) ChangeUsersPass(ctx context.Context, id int, oldPass string, newPass string, actorId int, actorRole string) error {
 	if id < 1 {
 		return ErrIdMustBeGtZero
 	}
-	if len(oldPass) < 6 {
-		return errors.New("old password must be greater than 6")
-	}
-	if len(newPass) < 6 {
-		return errors.New("new password must be greater than 6")
-	}
-
 	if oldPass == newPass {
 		return ErrNewPasswordIsSame
 	}
@@ -78,18 +106,28 @@ func (uservice *UserService) ChangeUsersPass(ctx context.Context, id int, oldPas
 	if err != nil {
 		return err
 	}
+	if err := uservice.policy.Validate(newPass, user.Name); err != nil {
+		return err
+	}
 
-	if !CompareHashAndPassword(user.Password, oldPass) {
+	match, err := uservice.hasher.Verify(user.Password, oldPass)
+	if err != nil {
+		return err
+	}
+	if !match {
 		return ErrOldPasswordIsWrong
 	}
 
-	newHashPass, err := Encrypter(newPass)
+	newHashPass, err := uservice.hasher.Hash(newPass)
 	if err != nil {
 		return err
 	}
 	user.Password = newHashPass
-	return uservice.repo.UpdatePassword(ctx, id, newHashPass, actorId, actorRole)
-
+	if err := uservice.repo.UpdatePassword(ctx, id, newHashPass, actorId, actorRole); err != nil {
+		return err
+	}
+	uservice.versions.forget(id)
+	return uservice.sessions.RevokeAllForUser(ctx, id)
 }
 
 func (uservice *UserService) DeleteUser(ctx context.Context, id int, actorId int, actorRole string) error {
@@ -97,27 +135,100 @@ func (uservice *UserService) DeleteUser(ctx context.Context, id int, actorId int
 		return ErrIdMustBeGtZero
 	}
 
-	if id != actorId && actorRole != ADMIN {
-		return errors.New("you can only delete yourself")
+	if err := uservice.repo.Delete(ctx, id, actorId, actorRole); err != nil {
+		return err
 	}
-	return uservice.repo.Delete(ctx, id, actorId, actorRole)
+	uservice.versions.forget(id)
+	return nil
 }
 
-func (uservice *UserService) UpdateUserRole(ctx context.Context, id int, actorId int, actorRole string) error {
+// UpdateUserRole gives the user newRole, giving a user the role they have is a no-op. Actors changing
+// their own role must confirm it. audit describes the actor and their request, it is completed and
+// written to the admin audit log along with the change
+func (uservice *UserService) UpdateUserRole(ctx context.Context, id int, newRole string, confirmed bool, audit AuditEntry) error {
 	if id < 1 {
 		return ErrIdMustBeGtZero
 	}
-	user, err := uservice.GetUserById(ctx, id, actorId, actorRole)
+	if !roleNamePattern.MatchString(newRole) {
+		return ErrInvalidRoleName
+	}
+	user, err := uservice.GetUserById(ctx, id, audit.ActorId, audit.ActorRole)
+	if err != nil {
+		return err
+	}
+	if user.Role == newRole {
+		return nil
+	}
+	if id == audit.ActorId && !confirmed {
+		return ErrRoleChangeNotConfirmed
+	}
+
+	audit.Action = AUDIT_ACTION_USER_ROLE
+	audit.TargetType = AUDIT_TARGET_USER
+	audit.TargetId = strconv.Itoa(id)
+	changed, err := uservice.repo.UpdateRole(ctx, id, newRole, audit)
 	if err != nil {
 		return err
 	}
-	var newUserRole string
-	if user.Role == USER {
-		newUserRole = ADMIN
-	} else {
-		newUserRole = USER
+	if changed {
+		uservice.versions.forget(id)
 	}
-	return uservice.repo.UpdateRole(ctx, id, newUserRole)
+	return nil
+}
+
+// GetUserByName looks a user up by name or verified email, without an ownership check, for flows that start before a login
+func (uservice *UserService) GetUserByName(ctx context.Context, name string) (*User, error) {
+	if len(name) < 1 {
+		return nil, ErrInvalidName
+	}
+	return uservice.repo.Authenticate(ctx, name)
+}
+
+// SetPassword sets a new password without the old one, the caller must have proven who the user is
+func (uservice *UserService) SetPassword(ctx context.Context, user *User, newPass string) error {
+	if err := uservice.policy.Validate(newPass, user.Name); err != nil {
+		return err
+	}
+	newHashPass, err := uservice.hasher.Hash(newPass)
+	if err != nil {
+		return err
+	}
+	if err := uservice.repo.UpdatePassword(ctx, user.Id, newHashPass, user.Id, USER); err != nil {
+		return err
+	}
+	uservice.versions.forget(user.Id)
+	return nil
+}
+
+// ChangeEmail sets a new email that has to be verified again, "" removes it
+func (uservice *UserService) ChangeEmail(ctx context.Context, id int, newEmail string, actorId int, actorRole string) error {
+	if id < 1 {
+		return ErrIdMustBeGtZero
+	}
+	var email *string
+	if newEmail != "" {
+		email = &newEmail
+	}
+	return uservice.repo.UpdateEmail(ctx, id, email, actorId, actorRole)
+}
+
+// VerifyEmail marks the user's email as verified if it still is email
+func (uservice *UserService) VerifyEmail(ctx context.Context, id int, email string) error {
+	return uservice.repo.VerifyEmail(ctx, id, email)
+}
+
+// AuthenticateUser logs in with a name or a verified email. It returns ErrInvalidCredentials for
+// unknown users and wrong passwords alike, in about the same time
+// ResolveLogin returns the id of the account a login name or verified email belongs to, 0 when there is none
+func (uservice *UserService) ResolveLogin(ctx context.Context, name string) (int, error) {
+	user, err := uservice.repo.Authenticate(ctx, name)
+	if errors.Is(err, ErrUserNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return user.Id, nil
 }
 
 func (uservice *UserService) AuthenticateUser(ctx context.Context, name string, password string) (*User, error) {
@@ -126,13 +237,64 @@ func (uservice *UserService) AuthenticateUser(ctx context.Context, name string,
 	}
 
 	user, err := uservice.repo.Authenticate(ctx, name)
+	if errors.Is(err, ErrUserNotFound) {
+		uservice.compareDummyPassword(password)
+		return nil, ErrInvalidCredentials
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if !CompareHashAndPassword(user.Password, password) {
-		return nil, ErrInvalidPassword
+	match, err := uservice.hasher.Verify(user.Password, password)
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return nil, ErrInvalidCredentials
+	}
+
+	// the password is only known here, so hashes made with bcrypt or older parameters are upgraded now
+	if uservice.hasher.NeedsRehash(user.Password) {
+		if err := uservice.rehashPassword(ctx, user, password); err != nil {
+			log.Println("Error rehashing password: ", err)
+		}
 	}
 
 	return user, nil
 }
+
+// rehashPassword replaces the hash of a password that was just verified, it doesn't count as a
+// password change, sessions stay valid
+func (uservice *UserService) rehashPassword(ctx context.Context, user *User, password string) error {
+	newHash, err := uservice.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := uservice.repo.RehashPassword(ctx, user.Id, user.Password, newHash); err != nil {
+		return err
+	}
+	user.Password = newHash
+	return nil
+}
+
+// compareDummyPassword takes as long as a failed Verify, logins of unknown users call it so response
+// times don't tell which usernames exist
+func (uservice *UserService) compareDummyPassword(password string) {
+	uservice.dummyHashOnce.Do(func() {
+		uservice.dummyHash, _ = uservice.hasher.Hash("dummy password")
+	})
+	uservice.hasher.Verify(uservice.dummyHash, password)
+}
+
+// TokenVersion returns the current token version of a user, cached for TOKEN_VERSION_CACHE_TTL
+func (uservice *UserService) TokenVersion(ctx context.Context, id int) (int, error) {
+	if version, ok := uservice.versions.get(id); ok {
+		return version, nil
+	}
+	version, err := uservice.repo.GetTokenVersion(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	uservice.versions.set(id, version)
+	return version, nil
+}
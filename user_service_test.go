@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUserNameIsNotAnEmail(t *testing.T) {
+	// the names are rejected before the repository is used
+	us := NewUserService(nil, testHasher(PASSWORD_HASH_ARGON2ID), &PasswordPolicy{MinLength: 1, MaxLength: 64}, nil)
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"alice@example.com", ErrNameIsEmail},
+		{"@alice", ErrNameIsEmail},
+		{"alice@", ErrNameIsEmail},
+	}
+
+	for _, tt := range tests {
+		if _, err := us.CreateNewUser(context.Background(), tt.name, "Correct9Horse"); !errors.Is(err, tt.err) {
+			t.Errorf("CreateNewUser(%q) error = %v, want %v", tt.name, err, tt.err)
+		}
+		if err := us.RenameUser(context.Background(), 1, tt.name, 1, USER); !errors.Is(err, tt.err) {
+			t.Errorf("RenameUser(%q) error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	if err := validateName("alice.example"); err != nil {
+		t.Errorf("validateName(%q) error = %v", "alice.example", err)
+	}
+}